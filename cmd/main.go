@@ -7,6 +7,7 @@ import (
 	gonanoid "github.com/matoous/go-nanoid/v2"
 	"github.com/spf13/cobra"
 	"github.com/vivgrid/yc/pkg"
+	"github.com/vivgrid/yc/pkg/fake"
 )
 
 func main() {
@@ -28,7 +29,7 @@ func main() {
 		Short: "Manage your globally deployed Serverless LLM Functions on vivgrid.com from the command line",
 	}
 
-	err = pkg.Execute(rootCmd, configFile, tid, "zipper.vivgrid.com", 3)
+	err = pkg.Execute(rootCmd, configFile, tid, "zipper.vivgrid.com", 3, fake.NewServerCmd())
 	if err != nil {
 		fmt.Println("cmd error:", err)
 		os.Exit(1)
@@ -0,0 +1,235 @@
+package pkg
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// archiveWriter writes files into a zip archive while enforcing the size
+// limits of zipOptions and keeping track of what has been included.
+type archiveWriter struct {
+	zw      *zip.Writer
+	cw      *countingWriter
+	options *zipOptions
+	files   []archivedFile
+}
+
+type archivedFile struct {
+	name string
+	size int64
+}
+
+// countingWriter counts the bytes written to the underlying writer.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+func newArchiveWriter(w io.Writer, options *zipOptions) *archiveWriter {
+	cw := &countingWriter{w: w}
+	return &archiveWriter{
+		zw:      zip.NewWriter(cw),
+		cw:      cw,
+		options: options,
+	}
+}
+
+// addFile writes the file at path into the archive under name.
+func (a *archiveWriter) addFile(path, name string) error {
+	fileInfo, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if max := a.options.maxFileSize; max > 0 && fileInfo.Size() > max {
+		return fmt.Errorf("file %s is %s, exceeding the max file size of %s; ignore it in .gitignore or raise the limit",
+			name, formatSize(fileInfo.Size()), formatSize(max))
+	}
+
+	header, err := zip.FileInfoHeader(fileInfo)
+	if err != nil {
+		return err
+	}
+	header.Name = name
+	header.Method = zip.Deflate
+
+	writer, err := a.zw.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if closeErr := f.Close(); closeErr != nil {
+			log.Printf("Warning: failed to close file %s: %v", path, closeErr)
+		}
+	}()
+
+	if _, err = io.Copy(writer, f); err != nil {
+		return err
+	}
+	a.files = append(a.files, archivedFile{name: name, size: fileInfo.Size()})
+
+	return a.checkArchiveSize()
+}
+
+// addSymlink stores the link at path as a symlink entry named name, pointing
+// to target relative to the link location.
+func (a *archiveWriter) addSymlink(path, target, name string) error {
+	fileInfo, err := os.Lstat(path)
+	if err != nil {
+		return err
+	}
+	realParent, err := filepath.EvalSymlinks(filepath.Dir(path))
+	if err != nil {
+		return err
+	}
+	link, err := filepath.Rel(realParent, target)
+	if err != nil {
+		return err
+	}
+
+	header, err := zip.FileInfoHeader(fileInfo)
+	if err != nil {
+		return err
+	}
+	header.Name = name
+	header.Method = zip.Store
+
+	writer, err := a.zw.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+	if _, err := io.WriteString(writer, filepath.ToSlash(link)); err != nil {
+		return err
+	}
+	a.files = append(a.files, archivedFile{name: name, size: int64(len(link))})
+
+	return a.checkArchiveSize()
+}
+
+// addDir adds every regular file under dir to the archive, stored under
+// prefix followed by its slash-separated path relative to dir.
+func (a *archiveWriter) addDir(dir, prefix string) error {
+	return filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		return a.addFile(p, path.Join(prefix, filepath.ToSlash(rel)))
+	})
+}
+
+// Close finishes the archive and logs a report of the largest included files.
+func (a *archiveWriter) Close() error {
+	if err := a.zw.Close(); err != nil {
+		return err
+	}
+	if err := a.checkArchiveSize(); err != nil {
+		return err
+	}
+	a.logLargestFiles()
+	return nil
+}
+
+// checkArchiveSize fails once the compressed archive grows past the limit.
+func (a *archiveWriter) checkArchiveSize() error {
+	max := a.options.maxArchiveSize
+	if max <= 0 || a.cw.n <= max {
+		return nil
+	}
+	a.logLargestFiles()
+	return fmt.Errorf("archive exceeds the max size of %s; ignore large files in .gitignore or raise the limit", formatSize(max))
+}
+
+// logLargestFiles logs the top-N largest files included so far.
+func (a *archiveWriter) logLargestFiles() {
+	n := a.options.largestFiles
+	if n <= 0 || len(a.files) == 0 {
+		return
+	}
+
+	files := make([]archivedFile, len(a.files))
+	copy(files, a.files)
+	sort.SliceStable(files, func(i, j int) bool { return files[i].size > files[j].size })
+	if len(files) > n {
+		files = files[:n]
+	}
+
+	log.Printf("Archive size: %s (%d files), largest files included:", formatSize(a.cw.n), len(a.files))
+	for _, f := range files {
+		log.Printf("\t%10s  %s", formatSize(f.size), f.name)
+	}
+}
+
+var sizeUnits = []string{"B", "KiB", "MiB", "GiB", "TiB"}
+
+// formatSize formats a byte count using binary units, e.g. 1.5 MiB.
+func formatSize(n int64) string {
+	if n < 1024 {
+		return strconv.FormatInt(n, 10) + " B"
+	}
+	size := float64(n)
+	unit := 0
+	for size >= 1024 && unit < len(sizeUnits)-1 {
+		size /= 1024
+		unit++
+	}
+	return fmt.Sprintf("%.1f %s", size, sizeUnits[unit])
+}
+
+// ParseSize parses a human readable byte size such as 512K, 100MB or 1GiB.
+// Units are powers of 1024, a plain number is a count of bytes.
+func ParseSize(s string) (int64, error) {
+	s = strings.TrimSpace(s)
+	i := strings.IndexFunc(s, func(r rune) bool { return (r < '0' || r > '9') && r != '.' })
+	num, unit := s, ""
+	if i >= 0 {
+		num, unit = s[:i], strings.ToUpper(strings.TrimSpace(s[i:]))
+	}
+
+	value, err := strconv.ParseFloat(num, 64)
+	if err != nil || value < 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+
+	var multiplier float64
+	switch strings.TrimSuffix(strings.TrimSuffix(unit, "B"), "I") {
+	case "":
+		multiplier = 1
+	case "K":
+		multiplier = 1 << 10
+	case "M":
+		multiplier = 1 << 20
+	case "G":
+		multiplier = 1 << 30
+	case "T":
+		multiplier = 1 << 40
+	default:
+		return 0, fmt.Errorf("invalid size unit in %q", s)
+	}
+	return int64(value * multiplier), nil
+}
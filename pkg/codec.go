@@ -0,0 +1,164 @@
+package pkg
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+)
+
+// Codec serializes request envelopes on the wire. The codec is negotiated in
+// the hello handshake, JSONCodec is spoken by every server.
+type Codec interface {
+	// Name is the codec name announced in the hello handshake.
+	Name() string
+	Marshal(req any) ([]byte, error)
+	Unmarshal(data []byte, req any) error
+}
+
+// BinaryMessage is implemented by messages carrying a large binary body.
+// FramedCodec sends the body as-is after the JSON header, instead of base64
+// encoding it inside the JSON document.
+type BinaryMessage interface {
+	Body() []byte
+	SetBody(body []byte)
+}
+
+// binaryEnvelope is implemented by Request, giving codecs access to its
+// message when it is a BinaryMessage.
+type binaryEnvelope interface {
+	binaryMessage() BinaryMessage
+}
+
+func (r *Request[T]) binaryMessage() BinaryMessage {
+	if bm, ok := any(r.Msg).(BinaryMessage); ok && r.Msg != nil {
+		return bm
+	}
+	return nil
+}
+
+var (
+	// JSONCodec encodes the whole envelope as a JSON document.
+	JSONCodec Codec = jsonCodec{}
+	// FramedCodec encodes the envelope as a JSON header followed by the body
+	// of BinaryMessage messages, see SplitFrame. Other messages are encoded
+	// as JSON documents. It only saves the base64 encoding of the body, the
+	// frame is a single payload holding a copy of the body, not a stream.
+	FramedCodec Codec = framedCodec{}
+)
+
+// supportedCodecs lists the codecs of this CLI, by preference.
+var supportedCodecs = []Codec{FramedCodec, JSONCodec}
+
+func codecNames(codecs []Codec) []string {
+	names := make([]string, len(codecs))
+	for i, codec := range codecs {
+		names[i] = codec.Name()
+	}
+	return names
+}
+
+// pickCodec returns the first supported codec also offered by the peer,
+// falling back to JSONCodec.
+func pickCodec(offered []string) Codec {
+	for _, codec := range supportedCodecs {
+		if slices.Contains(offered, codec.Name()) {
+			return codec
+		}
+	}
+	return JSONCodec
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Name() string { return "json" }
+
+func (jsonCodec) Marshal(req any) ([]byte, error) { return json.Marshal(req) }
+
+func (jsonCodec) Unmarshal(data []byte, req any) error { return json.Unmarshal(data, req) }
+
+// frameMagic starts every FramedCodec payload. It is followed by the big
+// endian uint32 length of the JSON header, the header and the binary body.
+var frameMagic = []byte("YCF1")
+
+const frameHeaderOffset = 8
+
+type framedCodec struct{}
+
+func (framedCodec) Name() string { return "framed" }
+
+func (framedCodec) Marshal(req any) ([]byte, error) {
+	var body []byte
+	if env, ok := req.(binaryEnvelope); ok {
+		if bm := env.binaryMessage(); bm != nil {
+			// the body is left out of the header, and restored right after
+			body = bm.Body()
+			bm.SetBody(nil)
+			defer bm.SetBody(body)
+		}
+	}
+
+	header, err := json.Marshal(req)
+	if err != nil || body == nil {
+		return header, err
+	}
+
+	frame := make([]byte, frameHeaderOffset, frameHeaderOffset+len(header)+len(body))
+	copy(frame, frameMagic)
+	binary.BigEndian.PutUint32(frame[len(frameMagic):], uint32(len(header)))
+	frame = append(frame, header...)
+	return append(frame, body...), nil
+}
+
+func (framedCodec) Unmarshal(data []byte, req any) error {
+	header, body, ok := SplitFrame(data)
+	if !ok {
+		return errors.New("invalid frame")
+	}
+	if err := json.Unmarshal(header, req); err != nil {
+		return err
+	}
+	if len(body) == 0 {
+		return nil
+	}
+
+	env, ok := req.(binaryEnvelope)
+	if !ok {
+		return fmt.Errorf("frame body can't be stored in %T", req)
+	}
+	bm := env.binaryMessage()
+	if bm == nil {
+		return fmt.Errorf("frame body can't be stored in %T", req)
+	}
+	bm.SetBody(body)
+	return nil
+}
+
+// SplitFrame splits a FramedCodec payload into its JSON header and binary
+// body. ok is false when data is not a valid frame.
+func SplitFrame(data []byte) (header, body []byte, ok bool) {
+	if !isFrame(data) || len(data) < frameHeaderOffset {
+		return nil, nil, false
+	}
+	n := binary.BigEndian.Uint32(data[len(frameMagic):frameHeaderOffset])
+	if uint64(n) > uint64(len(data)-frameHeaderOffset) {
+		return nil, nil, false
+	}
+	end := frameHeaderOffset + int(n)
+	return data[frameHeaderOffset:end], data[end:], true
+}
+
+func isFrame(data []byte) bool {
+	return bytes.HasPrefix(data, frameMagic)
+}
+
+// UnmarshalRequest decodes a request made with any codec, frames are
+// recognized by their magic number.
+func UnmarshalRequest(data []byte, req any) error {
+	if isFrame(data) {
+		return FramedCodec.Unmarshal(data, req)
+	}
+	return JSONCodec.Unmarshal(data, req)
+}
@@ -0,0 +1,96 @@
+package pkg
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+func TestCodecs(t *testing.T) {
+	zipData := []byte("PK\x03\x04 binary \x00\xff archive")
+
+	for _, codec := range []Codec{JSONCodec, FramedCodec} {
+		msg := &ReqMsgUpload{ZipData: zipData, Runtime: RuntimeGo}
+		req := &Request[ReqMsgUpload]{Version: SpecVersion, Target: "t", SfnName: "tool", Msg: msg}
+
+		data, err := codec.Marshal(req)
+		if err != nil {
+			t.Fatalf("%s: Marshal failed: %v", codec.Name(), err)
+		}
+		if !bytes.Equal(msg.ZipData, zipData) {
+			t.Errorf("%s: Marshal changed the message body", codec.Name())
+		}
+
+		var got Request[ReqMsgUpload]
+		if err := UnmarshalRequest(data, &got); err != nil {
+			t.Fatalf("%s: UnmarshalRequest failed: %v", codec.Name(), err)
+		}
+		if got.Target != "t" || got.SfnName != "tool" || got.Msg == nil || got.Msg.Runtime != RuntimeGo {
+			t.Errorf("%s: unexpected envelope %+v", codec.Name(), got)
+		}
+		if !bytes.Equal(got.Msg.ZipData, zipData) {
+			t.Errorf("%s: ZipData = %q, want %q", codec.Name(), got.Msg.ZipData, zipData)
+		}
+	}
+}
+
+func TestFramedCodecLayout(t *testing.T) {
+	body := bytes.Repeat([]byte{0xff}, 100)
+	req := &Request[ReqMsgUpload]{SfnName: "tool", Msg: &ReqMsgUpload{ZipData: body}}
+
+	data, err := FramedCodec.Marshal(req)
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+
+	header, gotBody, ok := SplitFrame(data)
+	if !ok {
+		t.Fatal("SplitFrame failed on a frame")
+	}
+	if !bytes.Equal(gotBody, body) {
+		t.Errorf("Frame body = %x, want %x", gotBody, body)
+	}
+	var envelope map[string]any
+	if err := json.Unmarshal(header, &envelope); err != nil {
+		t.Fatalf("Frame header is not JSON: %v", err)
+	}
+	if msg, _ := envelope["msg"].(map[string]any); msg == nil || msg["zip_data"] != nil {
+		t.Errorf("Frame header should not carry the body, got %s", header)
+	}
+
+	// messages without a binary body are plain JSON documents
+	data, err = FramedCodec.Marshal(&Request[ReqMsgCreate]{Msg: &ReqMsgCreate{}})
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	if !json.Valid(data) {
+		t.Errorf("Expected a JSON document, got %q", data)
+	}
+}
+
+func TestSplitFrameInvalid(t *testing.T) {
+	for _, data := range [][]byte{
+		[]byte(`{"version":2}`),
+		[]byte("YCF1"),
+		append([]byte("YCF1"), 0, 0, 1, 0, '{', '}'),
+	} {
+		if _, _, ok := SplitFrame(data); ok {
+			t.Errorf("SplitFrame(%q) should fail", data)
+		}
+	}
+
+	var req Request[ReqMsgCreate]
+	frame := append([]byte("YCF1"), 0, 0, 0, 2, '{', '}', 'x')
+	if err := UnmarshalRequest(frame, &req); err == nil {
+		t.Error("Expected error for a body in a message without BinaryMessage")
+	}
+}
+
+func TestPickCodec(t *testing.T) {
+	if codec := pickCodec([]string{"json", "framed"}); codec != FramedCodec {
+		t.Errorf("pickCodec() = %s, want framed", codec.Name())
+	}
+	if codec := pickCodec(nil); codec != JSONCodec {
+		t.Errorf("pickCodec(nil) = %s, want json", codec.Name())
+	}
+}
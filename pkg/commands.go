@@ -1,59 +1,138 @@
 package pkg
 
 import (
-	"archive/zip"
 	"bytes"
+	"cmp"
 	"context"
+	"crypto"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"log/slog"
 	"os"
+	"os/signal"
 	"path"
+	"path/filepath"
+	"runtime"
+	"slices"
 	"strings"
+	"sync"
 	"sync/atomic"
+	"syscall"
 	"time"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 	"github.com/yomorun/yomo"
 	"github.com/yomorun/yomo/serverless"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type command struct {
-	tid        string
-	zipperAddr string
-	secret     string
-	tool       string
-	meshNum    uint32
-	resCount   atomic.Uint32
-	resErr     atomic.Value
-	cancel     context.CancelFunc
-	envs       []string
+	tid         string
+	zipperAddr  string
+	secret      string
+	tool        string
+	meshNum     uint32
+	resCount    atomic.Uint32
+	resErr      atomic.Value
+	cancel      context.CancelFunc
+	out         io.Writer
+	envs        []string
+	vendor      bool
+	maxSize     string
+	maxFileSize string
+	explain     bool
+	symlinks    string
+	timeout     time.Duration
+	sentAt      atomic.Int64
+	specVersion uint32
+	hello       *ResMsgHello
+	helloErr    error
+	releaseURL  string
+	encoding    Encoding
+	codec       Codec
+	verbose     bool
+	debug       bool
+	logPath     string
+	logFile     *os.File
+	logger      *slog.Logger
+	tools       []ToolConfig
+	onResponse  func(res *Response)
+	zones       []string
+	// respondedZones are the zones which answered the current request
+	respondedZones sync.Map
+	// mesh are the discovered zones, meshSet when mesh is configured
+	mesh    []MeshZone
+	meshSet bool
+	logs    *logPrinter
+	// awaitAll waits for every zone instead of returning on the first error
+	awaitAll bool
+	// tracing exports the spans, from the rootSpan of the command down to
+	// the span of spanCtx, see tracing.go
+	tracing  *sdktrace.TracerProvider
+	rootSpan trace.Span
+	spanCtx  atomic.Pointer[context.Context]
 }
 
-func Execute(rootCmd *cobra.Command, configFile string, tid string, defaultZipperAddr string, defaultMeshNum uint32) error {
-	if _, ok := os.LookupEnv("YOMO_LOG_LEVEL"); !ok {
-		os.Setenv("YOMO_LOG_OUTPUT", "/dev/null")
-		os.Setenv("YOMO_LOG_ERROR_OUTPUT", "/dev/null")
+// Execute adds the yc commands to rootCmd and runs it. devCmds are added as
+// subcommands of `yc dev`, such as the local zipper emulator of package fake.
+func Execute(rootCmd *cobra.Command, configFile string, tid string, defaultZipperAddr string, defaultMeshNum uint32, devCmds ...*cobra.Command) error {
+	c := &command{
+		tid:         tid,
+		meshNum:     defaultMeshNum,
+		out:         rootCmd.OutOrStdout(),
+		specVersion: SpecVersion,
+		codec:       JSONCodec,
+		logger:      slog.New(slog.NewTextHandler(io.Discard, nil)),
 	}
 
-	c := &command{
-		tid:     tid,
-		meshNum: defaultMeshNum,
+	if runtime.GOOS == "windows" {
+		if exe, err := os.Executable(); err == nil {
+			removeOldExecutable(exe)
+		}
 	}
 
 	rootCmd.PersistentFlags().StringVar(&c.zipperAddr, "zipper", defaultZipperAddr, "zipper endpoint")
 	rootCmd.PersistentFlags().StringVar(&c.secret, "secret", "", "app secret")
-	rootCmd.PersistentFlags().StringVar(&c.tool, "tool", "my_first_llm_tool", "serverless LLM tool name")
+	rootCmd.PersistentFlags().StringVar(&c.tool, "tool", "my_first_llm_tool", "serverless LLM tool name, or comma separated names for deploy, status and remove")
+	rootCmd.PersistentFlags().BoolVarP(&c.verbose, "verbose", "v", false, "log the yomo transport and the requests and responses to stderr")
+	rootCmd.PersistentFlags().BoolVar(&c.debug, "debug", false, "like --verbose, with debug logs and the request and response payloads")
+	rootCmd.PersistentFlags().StringVar(&c.logPath, "log-file", "", "write the --verbose or --debug logs to a file instead of stderr")
+	rootCmd.PersistentPreRunE = func(cmd *cobra.Command, args []string) (err error) {
+		// the yomo logs, of the tools run by yc dev as well, are only shown
+		// with --debug or when configured
+		if _, ok := os.LookupEnv("YOMO_LOG_LEVEL"); !ok && !c.debug {
+			os.Setenv("YOMO_LOG_OUTPUT", "/dev/null")
+			os.Setenv("YOMO_LOG_ERROR_OUTPUT", "/dev/null")
+		}
+		c.logger, c.logFile, err = newLogger(c.verbose, c.debug, c.logPath)
+		if err != nil {
+			return err
+		}
+		return c.startTracing(cmd)
+	}
 
 	uploadCmd := c.addUploadCmd(rootCmd)
 	removeCmd := c.addRemoveCmd(rootCmd)
 	createCmd := c.addCreateCmd(rootCmd)
 
 	c.addVersionCmd(rootCmd)
+	c.addSelfUpdateCmd(rootCmd)
+	c.addDoctorCmd(rootCmd)
 	c.addStatusCmd(rootCmd)
+	c.addListCmd(rootCmd)
+	c.addMetricsCmd(rootCmd)
+	c.addTraceCmd(rootCmd)
+	c.addZonesCmd(rootCmd)
 	c.addLogsCmd(rootCmd)
+	c.addInvokeCmd(rootCmd)
+	c.addDescribeCmd(rootCmd)
 	c.addDeployCmd(rootCmd, uploadCmd, removeCmd, createCmd)
+	c.addDevCmd(rootCmd, devCmds...)
 	c.addDocCmd(rootCmd)
 
 	rootCmd.AddGroup(&cobra.Group{
@@ -94,13 +173,30 @@ func Execute(rootCmd *cobra.Command, configFile string, tid string, defaultZippe
 
 		if v.IsSet("mesh") {
 			c.meshNum = v.GetUint32("mesh")
+			c.meshSet = true
+		}
+
+		if v.IsSet("release_url") {
+			c.releaseURL = v.GetString("release_url")
+		}
+
+		if v.IsSet("tools") {
+			if err := v.UnmarshalKey("tools", &c.tools); err != nil {
+				return fmt.Errorf("tools: %w", err)
+			}
+			if err := validateTools(c.tools); err != nil {
+				return err
+			}
 		}
 	}
 
 	// Normalize zipperAddr after all configuration sources are processed
 	c.zipperAddr = normalizeZipperAddr(c.zipperAddr)
 
-	return rootCmd.Execute()
+	err := rootCmd.Execute()
+	c.stopTracing(err != nil)
+	c.closeLogFile()
+	return err
 }
 
 // normalizeZipperAddr ensures the zipper address has a port.
@@ -142,90 +238,206 @@ func (c *command) addDocCmd(rootCmd *cobra.Command) {
 	rootCmd.AddCommand(cmd)
 }
 
+// addDevCmd adds the local development command, which runs the tool locally
+// with hot reload, and groups devCmds.
+func (c *command) addDevCmd(rootCmd *cobra.Command, devCmds ...*cobra.Command) *cobra.Command {
+	var (
+		suffix   string
+		interval time.Duration
+	)
+	cmd := &cobra.Command{
+		Use:   "dev dir",
+		Short: "Run the tool locally against the zipper, rebuilding it on change",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+			defer stop()
+
+			s := &devSession{
+				dir:      args[0],
+				name:     c.tool + suffix,
+				zipper:   c.zipperAddr,
+				secret:   c.secret,
+				interval: interval,
+				out:      c.out,
+			}
+			return s.run(ctx)
+		},
+		GroupID: groupIDGeneral,
+	}
+	cmd.AddCommand(devCmds...)
+	rootCmd.AddCommand(cmd)
+	cmd.Flags().StringVar(&suffix, "suffix", "_dev", "Suffix appended to the tool name while developing")
+	cmd.Flags().DurationVar(&interval, "interval", time.Second, "Interval between checks for file changes")
+
+	return cmd
+}
+
 func (c *command) addVersionCmd(rootCmd *cobra.Command) {
+	var check, server bool
 	cmd := &cobra.Command{
 		Use:   "version",
 		Short: "Show version",
 		Args:  cobra.ExactArgs(0),
 		Run: func(cmd *cobra.Command, args []string) {
-			fmt.Println("version:", CliVersion)
+			fmt.Fprintln(c.out, "version:", CliVersion)
+			fmt.Fprintln(c.out, "spec versions:", supportedSpecVersions())
+
+			if check {
+				tag, err := newUpdater(c.releaseURL, nil).latest(cmd.Context())
+				if err != nil {
+					fmt.Fprintln(c.out, "Error:", err)
+					c.exit(1)
+				}
+				if isNewer(tag, CliVersion) {
+					fmt.Fprintf(c.out, "latest version: %s, run `yc self-update` to upgrade\n", tag)
+				} else {
+					fmt.Fprintf(c.out, "latest version: %s, yc is up to date\n", tag)
+				}
+			}
+
+			if !server {
+				return
+			}
+			// the zipper being unreachable is reported, not a failure
+			if err := c.negotiate(); err != nil {
+				fmt.Fprintln(c.out, "server version: unknown,", err)
+				return
+			}
+			if c.hello == nil {
+				fmt.Fprintln(c.out, "server version: unknown,", c.helloErr)
+				return
+			}
+			fmt.Fprintln(c.out, "server version:", c.hello.ServerVersion)
+			fmt.Fprintf(c.out, "server spec versions: %v (using %d)\n", c.hello.SpecVersions, c.specVersion)
 		},
 	}
 	rootCmd.AddCommand(cmd)
+	cmd.Flags().BoolVar(&server, "server", false, "Show the version of the server behind the zipper")
+	cmd.Flags().BoolVar(&check, "check", false, "Check whether a newer release is available")
+	cmd.Flags().StringVar(&c.releaseURL, "release-url", DefaultReleaseURL, "URL releases are downloaded from")
+}
+
+func (c *command) addDoctorCmd(rootCmd *cobra.Command) {
+	var timeout time.Duration
+	cmd := &cobra.Command{
+		Use:   "doctor",
+		Short: "Diagnose the connection to the zipper",
+		Args:  cobra.ExactArgs(0),
+		Run: func(cmd *cobra.Command, args []string) {
+			d := &doctor{c: c, timeout: timeout}
+			results := d.run(cmd.Context())
+			if failures := printCheckResults(c.out, results); failures > 0 {
+				fmt.Fprintf(c.out, "\n%d check(s) failed\n", failures)
+				c.exit(1)
+			}
+			fmt.Fprintln(c.out, "\nAll checks passed")
+		},
+		GroupID: groupIDGeneral,
+	}
+	rootCmd.AddCommand(cmd)
+	cmd.Flags().DurationVar(&timeout, "timeout", 5*time.Second, "Max time for each check")
+}
+
+func (c *command) addSelfUpdateCmd(rootCmd *cobra.Command) {
+	var (
+		version       string
+		publicKeyFile string
+		skipSignature bool
+	)
+	cmd := &cobra.Command{
+		Use:   "self-update",
+		Short: "Update yc to the latest release",
+		Args:  cobra.ExactArgs(0),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			publicKey, err := releasePublicKey(publicKeyFile, skipSignature)
+			if err != nil {
+				return err
+			}
+			u := newUpdater(c.releaseURL, publicKey)
+
+			tag := version
+			if tag == "" {
+				if tag, err = u.latest(cmd.Context()); err != nil {
+					return err
+				}
+				if !isNewer(tag, CliVersion) {
+					fmt.Fprintf(c.out, "yc %s is up to date\n", CliVersion)
+					return nil
+				}
+			}
+
+			exe, err := os.Executable()
+			if err != nil {
+				return err
+			}
+			if exe, err = filepath.EvalSymlinks(exe); err != nil {
+				return err
+			}
+
+			fmt.Fprintf(c.out, "Downloading yc %s from %s\n", tag, c.releaseURL)
+			binary, err := u.fetch(cmd.Context(), tag)
+			if err != nil {
+				return err
+			}
+			if err := replaceExecutable(exe, binary); err != nil {
+				return fmt.Errorf("failed to replace %s: %w", exe, err)
+			}
+			fmt.Fprintf(c.out, "Updated yc from %s to %s\n", CliVersion, tag)
+			return nil
+		},
+		GroupID: groupIDGeneral,
+	}
+	rootCmd.AddCommand(cmd)
+	cmd.Flags().StringVar(&version, "version", "", "Release tag to install instead of the latest, e.g. v1.2.3")
+	cmd.Flags().StringVar(&c.releaseURL, "release-url", DefaultReleaseURL, "URL releases are downloaded from")
+	cmd.Flags().StringVar(&publicKeyFile, "public-key", "", "PEM public key verifying the release signature, instead of the built-in one")
+	cmd.Flags().BoolVar(&skipSignature, "skip-signature", false, "Skip verifying the release signature, checksums are still verified")
+}
+
+// releasePublicKey returns the key verifying release signatures, read from
+// file or built in, nil when skipSignature is set.
+func releasePublicKey(file string, skipSignature bool) (crypto.PublicKey, error) {
+	if skipSignature {
+		return nil, nil
+	}
+	key := ReleasePublicKey
+	if file != "" {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		key = string(data)
+	}
+	if key == "" {
+		return nil, errors.New("no release public key is built into this yc, pass --public-key or --skip-signature")
+	}
+	return ParsePublicKey(key)
 }
 
 func (c *command) addUploadCmd(rootCmd *cobra.Command) *cobra.Command {
 	msg := &ReqMsgUpload{}
 	cmd := &cobra.Command{
-		Use:   "upload src_file[.go|.zip|dir]",
+		Use:   "upload src_file[.go|.ts|.py|.zip|dir]...",
 		Short: "Upload the source code and compile",
-		Args:  cobra.ExactArgs(1),
+		Args:  cobra.MinimumNArgs(1),
 		Run: run(
 			c,
 			TAG_REQUEST_UPLOAD,
 			msg,
 			func(args []string) error {
-				src := args[0]
-				info, err := os.Stat(src)
+				opts, err := c.zipOptions()
 				if err != nil {
 					return err
 				}
 
-				var data []byte
-
-				if info.IsDir() {
-					f, err := os.CreateTemp("", "app-*.zip")
-					if err != nil {
-						return err
-					}
-					zipPath := f.Name()
-					defer os.Remove(zipPath)
-					defer f.Close()
-
-					// Create custom ToZip function with exclusions
-					err = ZipWithExclusions(src, zipPath)
-					if err != nil {
-						return err
-					}
-
-					data, err = os.ReadFile(zipPath)
-					if err != nil {
-						return err
-					}
-				} else {
-					switch path.Ext(src) {
-					case ".zip":
-						data, err = os.ReadFile(src)
-						if err != nil {
-							return err
-						}
-					case ".go":
-						buf := new(bytes.Buffer)
-						writer := zip.NewWriter(buf)
-
-						f, err := writer.Create("app.go")
-						if err != nil {
-							return err
-						}
-
-						content, err := os.ReadFile(src)
-						if err != nil {
-							return err
-						}
-
-						_, err = f.Write(content)
-						if err != nil {
-							return err
-						}
-
-						writer.Close()
-						data = buf.Bytes()
-					default:
-						return errors.New("unsupported src file type")
-					}
+				data, runtime, err := c.pack(args, opts...)
+				if err != nil {
+					return err
 				}
 
 				msg.ZipData = data
+				msg.Runtime = runtime
 
 				return nil
 			},
@@ -233,10 +445,136 @@ func (c *command) addUploadCmd(rootCmd *cobra.Command) *cobra.Command {
 		GroupID: groupIDGeneral,
 	}
 	rootCmd.AddCommand(cmd)
+	c.addPackagingFlags(cmd)
 
 	return cmd
 }
 
+// addPackagingFlags adds the flags controlling how the upload archive is built.
+func (c *command) addPackagingFlags(cmd *cobra.Command) {
+	cmd.Flags().BoolVar(&c.vendor, "vendor", false, "Vendor Go module dependencies into the upload archive")
+	cmd.Flags().StringVar(&c.maxSize, "max-size", "100MiB", "Max size of the upload archive, 0 for no limit")
+	cmd.Flags().StringVar(&c.maxFileSize, "max-file-size", "50MiB", "Max size of a single file in the upload archive, 0 for no limit")
+	cmd.Flags().BoolVar(&c.explain, "explain", false, "Explain which ignore rule included or excluded each path")
+	cmd.Flags().StringVar(&c.symlinks, "symlinks", string(SymlinkFollow), "How to package symlinks: follow, store or reject")
+}
+
+// zipOptions builds the packaging options from the command flags.
+func (c *command) zipOptions() ([]ZipOption, error) {
+	maxSize, err := ParseSize(c.maxSize)
+	if err != nil {
+		return nil, fmt.Errorf("--max-size: %w", err)
+	}
+	maxFileSize, err := ParseSize(c.maxFileSize)
+	if err != nil {
+		return nil, fmt.Errorf("--max-file-size: %w", err)
+	}
+
+	symlinks, err := ParseSymlinkPolicy(c.symlinks)
+	if err != nil {
+		return nil, fmt.Errorf("--symlinks: %w", err)
+	}
+
+	opts := []ZipOption{
+		WithSymlinks(symlinks),
+		WithMaxArchiveSize(maxSize),
+		WithMaxFileSize(maxFileSize),
+		WithLargestFiles(largestFilesReported),
+	}
+	if c.vendor {
+		opts = append(opts, WithVendor())
+	}
+	if c.explain {
+		opts = append(opts, WithExplain(c.out))
+	}
+	return opts, nil
+}
+
+// packSource builds the zip archive to upload from the command arguments,
+// which are either a single directory, a single .zip file, or one or more
+// .go, .ts or .py files (glob patterns are expanded). It returns the archive
+// and the detected runtime.
+func packSource(args []string, opts ...ZipOption) ([]byte, Runtime, error) {
+	srcs, err := expandSources(args)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if len(srcs) == 1 {
+		src := srcs[0]
+		info, err := os.Stat(src)
+		if err != nil {
+			return nil, "", err
+		}
+
+		if info.IsDir() {
+			// Create custom ToZip function with exclusions
+			data, err := zipToBytes(func(zipPath string) error {
+				return ZipWithExclusions(src, zipPath, opts...)
+			})
+			return data, DetectRuntime(src), err
+		}
+
+		if path.Ext(src) == ".zip" {
+			data, err := os.ReadFile(src)
+			if err != nil {
+				return nil, "", err
+			}
+			if err := ValidateZip(data, opts...); err != nil {
+				return nil, "", err
+			}
+			return data, DetectZipRuntime(data), nil
+		}
+	}
+
+	spec := specForExt(path.Ext(srcs[0]))
+	if spec == nil {
+		return nil, "", errors.New("unsupported src file type")
+	}
+
+	data, err := zipToBytes(func(zipPath string) error {
+		return ZipSourceFiles(srcs, zipPath, opts...)
+	})
+	return data, spec.runtime, err
+}
+
+// expandSources expands glob patterns in args, plain paths are kept as-is.
+func expandSources(args []string) ([]string, error) {
+	var srcs []string
+	for _, arg := range args {
+		if !strings.ContainsAny(arg, "*?[") {
+			srcs = append(srcs, arg)
+			continue
+		}
+		matches, err := filepath.Glob(arg)
+		if err != nil {
+			return nil, err
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("no files match %s", arg)
+		}
+		srcs = append(srcs, matches...)
+	}
+	return srcs, nil
+}
+
+// zipToBytes runs f against a temporary zip file and returns its content.
+func zipToBytes(f func(zipPath string) error) ([]byte, error) {
+	tmp, err := os.CreateTemp("", "app-*.zip")
+	if err != nil {
+		return nil, err
+	}
+	zipPath := tmp.Name()
+	tmp.Close()
+	defer os.Remove(zipPath)
+
+	if err := f(zipPath); err != nil {
+		return nil, err
+	}
+
+	return os.ReadFile(zipPath)
+}
+
 func (c *command) addCreateCmd(rootCmd *cobra.Command) *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "create",
@@ -253,46 +591,221 @@ func (c *command) addCreateCmd(rootCmd *cobra.Command) *cobra.Command {
 		GroupID: groupIDDeployment,
 	}
 	rootCmd.AddCommand(cmd)
+	c.addZoneFlag(cmd)
 	cmd.Flags().StringArrayVar(&c.envs, "env", nil, "Set environment variable")
 	return cmd
 }
 
 func (c *command) addRemoveCmd(rootCmd *cobra.Command) *cobra.Command {
+	var all bool
 	cmd := &cobra.Command{
 		Use:   "remove",
 		Short: "Delete current serverless deployment",
 		Args:  cobra.ExactArgs(0),
-		Run: run(
+		Run: c.forEachTool(&all, run(
 			c,
 			TAG_REQUEST_REMOVE,
 			&ReqMsgRemove{},
 			nil,
-		),
+		), func(tc *command, _ ToolConfig) error {
+			return sendTool(tc, TAG_REQUEST_REMOVE, &ReqMsgRemove{})
+		}),
 		GroupID: groupIDDeployment,
 	}
 	rootCmd.AddCommand(cmd)
+	c.addZoneFlag(cmd)
+	cmd.Flags().BoolVar(&all, "all", false, "Remove every tool of yc.yml concurrently")
 
 	return cmd
 }
 
 func (c *command) addStatusCmd(rootCmd *cobra.Command) {
+	var all bool
 	cmd := &cobra.Command{
 		Use:   "status",
 		Short: "Show serverless status",
 		Args:  cobra.ExactArgs(0),
-		Run: run(
+		Run: c.forEachTool(&all, run(
 			c,
 			TAG_REQUEST_STATUS,
 			&ReqMsgStatus{},
 			nil,
-		),
+		), func(tc *command, _ ToolConfig) error {
+			return sendTool(tc, TAG_REQUEST_STATUS, &ReqMsgStatus{})
+		}),
 		GroupID: groupIDMonitoring,
 	}
 	rootCmd.AddCommand(cmd)
+	c.addZoneFlag(cmd)
+	cmd.Flags().BoolVar(&all, "all", false, "Show the status of every tool of yc.yml")
+}
+
+func (c *command) addListCmd(rootCmd *cobra.Command) {
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "List the tools deployed in the app with their status in each zone",
+		Args:  cobra.ExactArgs(0),
+		Run: func(cmd *cobra.Command, args []string) {
+			responses, err := c.listTools()
+			if err != nil {
+				fmt.Fprintln(c.out, "Error:", err)
+				c.exit(1)
+			}
+			printToolList(c.out, responses)
+			c.warnMissingZones(c.out)
+		},
+		GroupID: groupIDMonitoring,
+	}
+	rootCmd.AddCommand(cmd)
+}
+
+func (c *command) addMetricsCmd(rootCmd *cobra.Command) {
+	var since, until, output string
+	cmd := &cobra.Command{
+		Use:   "metrics",
+		Short: "Show the invocations, errors, latency, memory and CPU of the tool in each zone",
+		Args:  cobra.ExactArgs(0),
+		Run: func(cmd *cobra.Command, args []string) {
+			if !slices.Contains([]string{outputTable, outputChart, outputJSON}, output) {
+				fmt.Fprintf(c.out, "Error: invalid --output %q, use %s, %s or %s\n", output, outputTable, outputChart, outputJSON)
+				c.exit(1)
+			}
+			now := time.Now()
+			msg := &ReqMsgMetrics{Until: now, Points: metricsPoints}
+			var err error
+			if msg.Since, err = parseLogTime(since, now); err == nil && until != "" {
+				msg.Until, err = parseLogTime(until, now)
+			}
+			if err == nil && !msg.Since.Before(msg.Until) {
+				err = fmt.Errorf("--since %s is not before --until %s", since, cmp.Or(until, "now"))
+			}
+			if err != nil {
+				fmt.Fprintln(c.out, "Error:", err)
+				c.exit(1)
+			}
+
+			responses, err := collect(c, TAG_REQUEST_METRICS, msg)
+			if err != nil {
+				fmt.Fprintln(c.out, "Error:", err)
+				c.exit(1)
+			}
+			printMetrics(c.out, output, msg.Since, msg.Until, parseMetrics(responses))
+			if output != outputJSON {
+				c.warnMissingZones(c.out)
+			}
+		},
+		GroupID: groupIDMonitoring,
+	}
+	rootCmd.AddCommand(cmd)
+	c.addZoneFlag(cmd)
+	cmd.Flags().StringVar(&since, "since", "1h", "Start of the window, a duration ago, e.g. 2h, or an RFC 3339 time")
+	cmd.Flags().StringVar(&until, "until", "", "End of the window, a duration ago or an RFC 3339 time, now by default")
+	cmd.Flags().StringVarP(&output, "output", "o", outputTable, "Output format: table, chart for sparklines, or json")
+}
+
+func (c *command) addTraceCmd(rootCmd *cobra.Command) {
+	var (
+		last   int
+		output string
+	)
+	cmd := &cobra.Command{
+		Use:   "trace [request_id]",
+		Short: "Show the traces of the last invocations of the tool as a waterfall",
+		Args:  cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			if output != outputText && output != outputOTLP {
+				fmt.Fprintf(c.out, "Error: invalid --output %q, use %s or %s\n", output, outputText, outputOTLP)
+				c.exit(1)
+			}
+			if last <= 0 {
+				fmt.Fprintf(c.out, "Error: invalid --last %d, it must be positive\n", last)
+				c.exit(1)
+			}
+			msg := &ReqMsgTrace{Last: last}
+			if len(args) > 0 {
+				msg.RequestID = args[0]
+			}
+
+			responses, err := collect(c, TAG_REQUEST_TRACE, msg)
+			if err != nil {
+				fmt.Fprintln(c.out, "Error:", err)
+				c.exit(1)
+			}
+			traces, failures := parseTraces(responses)
+			if msg.RequestID == "" && len(traces) > last {
+				// the last invocations of every zone
+				traces = traces[len(traces)-last:]
+			}
+
+			// the errors don't mix with the exported JSON
+			errOut := c.out
+			if output == outputOTLP {
+				buf, _ := json.MarshalIndent(toOTLP(traces), "", "  ")
+				fmt.Fprintf(c.out, "%s\n", buf)
+				errOut = cmd.ErrOrStderr()
+			} else {
+				printTraces(c.out, traces)
+			}
+			for _, e := range failures {
+				fmt.Fprintln(errOut, e)
+			}
+			c.warnMissingZones(errOut)
+		},
+		GroupID: groupIDMonitoring,
+	}
+	rootCmd.AddCommand(cmd)
+	c.addZoneFlag(cmd)
+	cmd.Flags().IntVar(&last, "last", 5, "Number of invocations to show, without a request id")
+	cmd.Flags().StringVarP(&output, "output", "o", outputText, "Output format: text for a waterfall, or otlp for OTLP JSON")
+}
+
+func (c *command) addZonesCmd(rootCmd *cobra.Command) {
+	cmd := &cobra.Command{
+		Use:   "zones",
+		Short: "Show the zones of the mesh with their region and health",
+		Args:  cobra.ExactArgs(0),
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := c.negotiate(); err != nil {
+				fmt.Fprintln(c.out, "Error:", err)
+				c.exit(1)
+			}
+			mesh := c.mesh
+			if len(mesh) == 0 {
+				if c.hello == nil || !c.supports(TAG_REQUEST_MESH) {
+					fmt.Fprintln(c.out, "Error: the zipper does not support mesh discovery, please upgrade it")
+					c.exit(1)
+				}
+				var err error
+				if mesh, err = c.discoverMesh(15 * time.Second); err != nil {
+					fmt.Fprintln(c.out, "Error:", err)
+					c.exit(1)
+				}
+			}
+			printMesh(c.out, mesh)
+		},
+		GroupID: groupIDMonitoring,
+	}
+	rootCmd.AddCommand(cmd)
+}
+
+// addZoneFlag adds the flag restricting the request to some zones.
+func (c *command) addZoneFlag(cmd *cobra.Command) {
+	cmd.Flags().StringArrayVar(&c.zones, "zone", nil, "Only act in this mesh zone, can be repeated")
 }
 
 func (c *command) addLogsCmd(rootCmd *cobra.Command) {
-	var tail int
+	var (
+		tail           int
+		output         string
+		reorder        time.Duration
+		since, until   string
+		noFollow       bool
+		timeout        time.Duration
+		saveDir        string
+		saveMaxSize    int
+		saveMaxBackups int
+	)
+	msg := &ReqMsgLogs{Structured: true}
 	cmd := &cobra.Command{
 		Use:   "logs",
 		Short: "Observe serverless logs in real-time",
@@ -300,123 +813,465 @@ func (c *command) addLogsCmd(rootCmd *cobra.Command) {
 		Run: run(
 			c,
 			TAG_REQUEST_LOGS,
-			&ReqMsgLogs{},
-			nil,
+			msg,
+			func([]string) (err error) {
+				now := time.Now()
+				if msg.Since, err = parseLogTime(since, now); err != nil {
+					return err
+				}
+				if msg.Until, err = parseLogTime(until, now); err != nil {
+					return err
+				}
+				if !msg.Until.IsZero() && msg.Until.Before(msg.Since) {
+					return fmt.Errorf("--until %s is before --since %s", until, since)
+				}
+				// nothing is written after --until, there is nothing to follow
+				msg.NoFollow = noFollow || !msg.Until.IsZero()
+				if (msg.NoFollow || !msg.Since.IsZero()) && !c.supportsLogsRange() {
+					return errors.New("the zipper does not support --since, --until and --no-follow, please upgrade it")
+				}
+				c.timeout = timeout
+
+				c.logs, err = newLogPrinter(c.out, output, reorder)
+				if err != nil || saveDir == "" {
+					return err
+				}
+				c.logs.files, err = newLogFiles(saveDir, c.tool, saveMaxSize, saveMaxBackups)
+				if err == nil {
+					fmt.Fprintf(c.out, "Saving the logs of each zone to %s\n", saveDir)
+				}
+				return err
+			},
 		),
 		GroupID: groupIDMonitoring,
 	}
 	rootCmd.AddCommand(cmd)
+	c.addZoneFlag(cmd)
 	cmd.Flags().IntVar(&tail, "tail", 20, "Tail logs")
+	cmd.Flags().StringVarP(&output, "output", "o", outputText, "Output format: text, or json for a JSON object per line")
+	cmd.Flags().DurationVar(&reorder, "reorder", 0, "Hold log lines for this long to merge the zones by timestamp, e.g. 500ms")
+	cmd.Flags().StringVar(&since, "since", "", "Show the logs written since a duration ago, e.g. 2h, or an RFC 3339 time")
+	cmd.Flags().StringVar(&until, "until", "", "Show the logs written until a duration ago, e.g. 1h, or an RFC 3339 time, implies --no-follow")
+	cmd.Flags().BoolVar(&noFollow, "no-follow", false, "Exit once the zones have sent their logs instead of following them")
+	cmd.Flags().DurationVar(&timeout, "timeout", time.Minute, "Max time to wait for the zones to send their logs with --no-follow")
+	cmd.Flags().StringVar(&saveDir, "save", "", "Write the logs of each zone to a rotating file in this directory instead of the output")
+	cmd.Flags().IntVar(&saveMaxSize, "save-max-size", 100, "Rotate the --save files once they reach this size in megabytes")
+	cmd.Flags().IntVar(&saveMaxBackups, "save-max-backups", 5, "Number of rotated --save files kept per zone, 0 keeps them all")
+}
+
+func (c *command) addInvokeCmd(rootCmd *cobra.Command) {
+	var (
+		args       string
+		argsFile   string
+		noValidate bool
+	)
+	msg := &ReqMsgInvoke{}
+	cmd := &cobra.Command{
+		Use:   "invoke",
+		Short: "Call the tool with JSON arguments and show the result of each zone",
+		Args:  cobra.ExactArgs(0),
+		Run: run(
+			c,
+			TAG_REQUEST_INVOKE,
+			msg,
+			func([]string) error {
+				data, err := invokeArgs(args, argsFile)
+				if err != nil {
+					return err
+				}
+				if !noValidate {
+					if data, err = c.checkInvokeArgs(data); err != nil {
+						return err
+					}
+				}
+				if data == nil {
+					data = json.RawMessage("{}")
+				}
+				msg.Args = data
+				return nil
+			},
+		),
+		GroupID: groupIDGeneral,
+	}
+	rootCmd.AddCommand(cmd)
+	cmd.Flags().StringVar(&args, "args", "", "Function call arguments as a JSON object, prompted for when omitted in a terminal")
+	cmd.Flags().StringVar(&argsFile, "args-file", "", "File containing the function call arguments, - for stdin")
+	cmd.Flags().DurationVar(&c.timeout, "timeout", 15*time.Second, "Max time to wait for the results")
+	cmd.Flags().BoolVar(&noValidate, "no-validate", false, "Skip validating the arguments against the tool input schema")
+}
+
+// invokeArgs returns the function call arguments given by --args or
+// --args-file, nil when neither is set.
+func invokeArgs(args, argsFile string) (json.RawMessage, error) {
+	var data []byte
+	switch {
+	case args != "" && argsFile != "":
+		return nil, errors.New("--args and --args-file are mutually exclusive")
+	case args != "":
+		data = []byte(args)
+	case argsFile == "-":
+		b, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return nil, err
+		}
+		data = b
+	case argsFile != "":
+		b, err := os.ReadFile(argsFile)
+		if err != nil {
+			return nil, err
+		}
+		data = b
+	default:
+		return nil, nil
+	}
+
+	var obj map[string]json.RawMessage
+	if err := json.Unmarshal(data, &obj); err != nil || obj == nil {
+		return nil, errors.New("function call arguments must be a JSON object")
+	}
+	return json.RawMessage(bytes.TrimSpace(data)), nil
+}
+
+// checkInvokeArgs validates args against the input schema of the deployed
+// tool. When args is nil and stdin is a terminal, the arguments are prompted
+// for instead. A tool which can't be described is invoked without checks.
+func (c *command) checkInvokeArgs(args json.RawMessage) (json.RawMessage, error) {
+	desc, err := c.describeTool(c.timeout)
+	if err != nil {
+		fmt.Fprintln(c.out, "Warning: arguments are not validated, failed to fetch the tool input schema:", err)
+		return args, nil
+	}
+	schema, err := ParseSchema(desc.InputSchema)
+	if err != nil || schema == nil {
+		return args, err
+	}
+
+	if args == nil {
+		if !isTerminal(os.Stdin) {
+			args = json.RawMessage("{}")
+		} else if args, err = PromptArgs(os.Stdin, c.out, schema); err != nil {
+			return nil, err
+		}
+	}
+	if err := schema.Validate(args); err != nil {
+		return nil, fmt.Errorf("invalid arguments: %w", err)
+	}
+	return args, nil
+}
+
+// isTerminal reports whether f is an interactive terminal.
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+func (c *command) addDescribeCmd(rootCmd *cobra.Command) {
+	var timeout time.Duration
+	cmd := &cobra.Command{
+		Use:   "describe",
+		Short: "Show the description and input schema of the tool",
+		Args:  cobra.ExactArgs(0),
+		Run: func(cmd *cobra.Command, args []string) {
+			desc, err := c.describeTool(timeout)
+			if err != nil {
+				fmt.Fprintln(c.out, "Error:", err)
+				c.exit(1)
+			}
+
+			fmt.Fprintln(c.out, "Tool:", c.tool)
+			fmt.Fprintln(c.out, "Description:", desc.Description)
+			var schema bytes.Buffer
+			if err := json.Indent(&schema, desc.InputSchema, "", "  "); err != nil || schema.Len() == 0 {
+				fmt.Fprintln(c.out, "Input schema: none")
+				return
+			}
+			fmt.Fprintf(c.out, "Input schema:\n%s\n", schema.String())
+		},
+		GroupID: groupIDGeneral,
+	}
+	rootCmd.AddCommand(cmd)
+	cmd.Flags().DurationVar(&timeout, "timeout", 15*time.Second, "Max time to wait for the description")
+}
+
+// describeTool fetches the description and input schema of the tool from the
+// first zone answering successfully.
+func (c *command) describeTool(timeout time.Duration) (*ResMsgDescribe, error) {
+	if err := c.negotiate(); err != nil {
+		return nil, err
+	}
+	if !c.supports(TAG_REQUEST_DESCRIBE) {
+		return nil, errors.New("the zipper does not support describe")
+	}
+
+	res, err := query(c, TAG_REQUEST_DESCRIBE, &ReqMsgDescribe{}, timeout)
+	if err != nil {
+		return nil, err
+	}
+	var desc ResMsgDescribe
+	if err := json.Unmarshal([]byte(res.Msg), &desc); err != nil {
+		return nil, fmt.Errorf("[%s] invalid description: %w", res.MeshZone, err)
+	}
+	return &desc, nil
 }
 
 func (c *command) addDeployCmd(rootCmd *cobra.Command, uploadCmd *cobra.Command, removeCmd *cobra.Command, createCmd *cobra.Command) {
+	var all bool
 	cmd := &cobra.Command{
-		Use:   "deploy src_file[.go|.zip|dir]",
+		Use:   "deploy [src_file[.go|.ts|.py|.zip|dir]...]",
 		Short: "Deploy your serverless, this is an alias of chaining commands (upload -> remove -> create)",
-		Args:  cobra.ExactArgs(1),
-		Run: func(cmd *cobra.Command, args []string) {
+		Run: c.forEachTool(&all, func(cmd *cobra.Command, args []string) {
+			if len(args) == 0 {
+				tools, _, _ := c.selectTools(false)
+				if tools[0].Src == "" {
+					fmt.Fprintf(c.out, "Error: no source given and tool %s has no src in yc.yml\n", c.tool)
+					c.exit(1)
+				}
+				args = []string{tools[0].Src}
+				c.envs = append(slices.Clone(tools[0].Envs), c.envs...)
+			}
+
 			uploadCmd.Run(uploadCmd, args)
 			if errMsg := c.lastError(); errMsg != "" {
-				os.Exit(1)
+				c.exit(1)
 			}
 			removeCmd.Run(removeCmd, args)
 			if errMsg := c.lastError(); errMsg != "" {
-				os.Exit(1)
+				c.exit(1)
 			}
 			createCmd.Run(createCmd, args)
 			if errMsg := c.lastError(); errMsg != "" {
-				os.Exit(1)
+				c.exit(1)
 			}
 
-			fmt.Println("Successfully!")
-		},
+			fmt.Fprintln(c.out, "Successfully!")
+		}, c.deployTool),
 		GroupID: groupIDGeneral,
 	}
 	rootCmd.AddCommand(cmd)
 	cmd.Flags().StringArrayVar(&c.envs, "env", nil, "Set environment variables")
+	cmd.Flags().BoolVar(&all, "all", false, "Deploy every tool of yc.yml concurrently")
+	c.addPackagingFlags(cmd)
 }
 
 func run[T any](c *command, tag uint32, reqMsg *T, f func([]string) error) func(cmd *cobra.Command, args []string) {
 	return func(cmd *cobra.Command, args []string) {
-		sfn := yomo.NewStreamFunction("res:"+c.tid, c.zipperAddr, yomo.WithSfnCredential(c.secret))
-		sfn.SetHandler(c.handler)
-		sfn.SetObserveDataTags(ResponseTag(tag))
-		sfn.SetWantedTarget(c.tid)
-		err := sfn.Connect()
-		if err != nil {
-			fmt.Println("Error:", err)
-			os.Exit(1)
+		if err := send(c, tag, reqMsg, f, args); err != nil {
+			fmt.Fprintln(c.out, "Error:", err)
+			c.exit(1)
 		}
-		defer sfn.Close()
+	}
+}
 
-		source := yomo.NewSource("req:"+c.tid, c.zipperAddr, yomo.WithCredential(c.secret))
-		err = source.Connect()
-		if err != nil {
-			fmt.Println("Error:", err)
-			os.Exit(1)
+// send sends the request to every zone and waits for their responses, which
+// are handled by c.handler. Errors reported by the zones are recorded in
+// c.resErr, the returned error is about sending the request.
+func send[T any](c *command, tag uint32, reqMsg *T, f func([]string) error, args []string) (err error) {
+	// the packaging and the responses of the zones are children of the span
+	parent := c.traceCtx()
+	spanCtx, span := c.startSpan(capabilities[tag], trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(
+		attribute.String("yc.tool", c.tool),
+		attribute.StringSlice("yc.zones", c.zones),
+	))
+	c.spanCtx.Store(&spanCtx)
+	defer func() {
+		c.spanCtx.Store(&parent)
+		span.SetAttributes(attribute.Int64("yc.responses", int64(c.resCount.Load())))
+		spanErr := err
+		if msg := c.lastError(); spanErr == nil && msg != "" {
+			spanErr = errors.New(msg)
 		}
-		defer source.Close()
+		endSpan(span, spanErr)
+	}()
 
-		if f != nil {
-			err = f(args)
-			if err != nil {
-				fmt.Println("Error:", err)
-				os.Exit(1)
-			}
+	if err := c.negotiate(); err != nil {
+		return err
+	}
+	if !c.supports(tag) {
+		return fmt.Errorf("the zipper does not support %s, please upgrade it", capabilities[tag])
+	}
+	if len(c.zones) > 0 && !c.supportsZones() {
+		return errors.New("the zipper does not support --zone, please upgrade it")
+	}
+	c.resCount.Store(0)
+	c.respondedZones.Clear()
+
+	// c.handler cancels ctx once the zones responded, it must be set before
+	// the responses can arrive
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	c.cancel = cancel
+
+	sfn := yomo.NewStreamFunction("res:"+c.tid, c.zipperAddr, yomo.WithSfnCredential(c.secret), yomo.WithSfnLogger(c.logger))
+	// the handlers may outlive sfn.Close, the responses arriving once the
+	// request is over are dropped instead of racing with the next request
+	var (
+		handling sync.RWMutex
+		over     bool
+	)
+	stopHandling := func() {
+		handling.Lock()
+		over = true
+		handling.Unlock()
+	}
+	defer stopHandling()
+	sfn.SetHandler(func(yctx serverless.Context) {
+		handling.RLock()
+		defer handling.RUnlock()
+		if !over {
+			c.handler(yctx)
 		}
+	})
+	sfn.SetObserveDataTags(ResponseTag(tag))
+	sfn.SetWantedTarget(c.tid)
+	if err := sfn.Connect(); err != nil {
+		return err
+	}
+	defer sfn.Close()
 
-		req := &Request[T]{
-			Version: SpecVersion,
-			Target:  c.tid,
-			SfnName: c.tool,
-			Msg:     reqMsg,
+	source := yomo.NewSource("req:"+c.tid, c.zipperAddr, yomo.WithCredential(c.secret), yomo.WithLogger(c.logger))
+	if err := source.Connect(); err != nil {
+		return err
+	}
+	defer source.Close()
+
+	if f != nil {
+		if err := f(args); err != nil {
+			return err
 		}
+	}
 
-		buf, _ := json.Marshal(req)
+	req := &Request[T]{
+		Version: c.specVersion,
+		Target:  c.tid,
+		SfnName: c.tool,
+		Zones:   c.zones,
+		Msg:     reqMsg,
+	}
+	encode := func() ([]byte, error) {
+		buf, err := c.codec.Marshal(req)
+		if err == nil {
+			buf, err = EncodePayload(buf, c.encoding)
+		}
+		if err == nil {
+			c.logRequest(tag, req, len(buf))
+		}
+		return buf, err
+	}
 
-		var ctx context.Context
-		switch tag {
-		case TAG_REQUEST_LOGS:
-			ctx, c.cancel = context.WithCancel(context.Background())
-			go func() {
-				for {
-					source.Write(tag, buf)
-					time.Sleep(time.Second * 15)
-				}
-			}()
-		case TAG_REQUEST_UPLOAD:
-			ctx, c.cancel = context.WithCancel(context.Background())
-			source.Write(tag, buf)
-		default:
-			ctx, c.cancel = context.WithTimeout(context.Background(), time.Second*15)
+	buf, err := encode()
+	if err != nil {
+		return err
+	}
+
+	// the timeouts start once the request is sent
+	stop := cancel
+	c.sentAt.Store(time.Now().UnixNano())
+	switch tag {
+	case TAG_REQUEST_LOGS:
+		if msg, ok := any(reqMsg).(*ReqMsgLogs); ok && msg.NoFollow {
+			// the zones end the stream, see allResponded
+			ctx, stop = context.WithTimeout(ctx, c.timeout)
 			source.Write(tag, buf)
+			break
 		}
+		source.Write(tag, buf)
+		go func() {
+			ticker := time.NewTicker(logsResubscribeInterval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+				}
+
+				// resume each instance after the last line received
+				if msg, ok := any(reqMsg).(*ReqMsgLogs); ok && c.logs != nil {
+					msg.Cursors = c.logs.lastSeqs()
+					if b, err := encode(); err == nil {
+						buf = b
+					}
+				}
+				source.Write(tag, buf)
+			}
+		}()
+	case TAG_REQUEST_UPLOAD:
+		source.Write(tag, buf)
+	case TAG_REQUEST_INVOKE:
+		ctx, stop = context.WithTimeout(ctx, c.timeout)
+		source.Write(tag, buf)
+	default:
+		ctx, stop = context.WithTimeout(ctx, time.Second*15)
+		source.Write(tag, buf)
+	}
+	defer stop()
+
+	<-ctx.Done()
+	if tag == TAG_REQUEST_LOGS {
+		// the lines are handled concurrently, the last ones may trail the end
+		// of the stream
+		time.Sleep(logsDrainDelay)
+	}
+	stopHandling()
+	if c.logs != nil {
+		c.logs.close()
+	}
 
-		<-ctx.Done()
+	if (tag == TAG_REQUEST_INVOKE || tag == TAG_REQUEST_LOGS) && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		errMsg := fmt.Sprintf("timed out after %s, %d of %d zones responded", c.timeout, c.resCount.Load(), c.expectedResponses())
+		fmt.Fprintln(c.out, "Error:", errMsg)
+		c.resErr.Store(errMsg)
+	} else if len(c.awaitedZones()) > 0 && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		fmt.Fprintln(c.out, "Warning: no response from", c.missingZones())
 	}
+	return nil
 }
 
 func (c *command) handler(yctx serverless.Context) {
+	data, err := DecodePayload(yctx.Data())
+	if err != nil {
+		fmt.Fprintln(c.out, err)
+		return
+	}
+
 	var res Response
-	err := json.Unmarshal(yctx.Data(), &res)
+	err = json.Unmarshal(data, &res)
 	if err != nil {
-		fmt.Println(err)
+		fmt.Fprintln(c.out, err)
 		return
 	}
+	c.logResponse(yctx.Tag(), &res, len(yctx.Data()))
+	if yctx.Tag() != TAG_RESPONSE_LOGS || res.Done || res.Error != "" {
+		c.traceResponse(&res, len(yctx.Data()))
+	}
+	if c.onResponse != nil {
+		c.onResponse(&res)
+	}
 
-	if res.Error != "" {
-		fmt.Printf("[%s] Error: %s\n", res.MeshZone, res.Error)
+	if res.Error != "" && c.logs != nil {
+		c.logs.printError(&res)
+		c.resErr.Store(res.Error)
+	} else if res.Error != "" {
+		fmt.Fprintf(c.out, "[%s] Error: %s\n", res.MeshZone, res.Error)
 		c.resErr.Store(res.Error)
+	} else if yctx.Tag() == TAG_RESPONSE_LOGS && c.logs != nil {
+		if res.Msg != "" {
+			c.logs.print(&res)
+		}
+	} else if yctx.Tag() == TAG_RESPONSE_INVOKE {
+		latency := time.Since(time.Unix(0, c.sentAt.Load())).Round(time.Millisecond)
+		fmt.Fprintf(c.out, "[%s] OK (%s): %s\n", res.MeshZone, latency, res.Msg)
 	} else if res.Msg != "" {
-		fmt.Printf("[%s] OK: %s\n", res.MeshZone, res.Msg)
+		fmt.Fprintf(c.out, "[%s] OK: %s\n", res.MeshZone, res.Msg)
 	}
 
 	if res.Done {
 		c.resCount.Add(1)
+		c.respondedZones.Store(res.MeshZone, true)
 	}
 	count := c.resCount.Load()
 	if count > 0 {
-		if yctx.Tag() == TAG_RESPONSE_UPLOAD || count >= c.meshNum || c.lastError() != "" {
+		if yctx.Tag() == TAG_RESPONSE_UPLOAD || c.allResponded() || (c.lastError() != "" && !c.awaitAll) {
 			c.cancel()
 		}
 	}
@@ -427,6 +1282,13 @@ const (
 	groupIDMonitoring = "monitoring"
 	groupIDGeneral    = "general"
 
-	colorReset = "\033[0m"
-	colorBlue  = "\033[34m"
+	// largestFilesReported is the number of files listed in the archive size report
+	largestFilesReported = 5
+
+	colorReset  = "\033[0m"
+	colorRed    = "\033[31m"
+	colorGreen  = "\033[32m"
+	colorYellow = "\033[33m"
+	colorBlue   = "\033[34m"
+	colorGray   = "\033[90m"
 )
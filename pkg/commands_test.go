@@ -0,0 +1,805 @@
+package pkg_test
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/vivgrid/yc/pkg"
+	"github.com/vivgrid/yc/pkg/fake"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+// syncBuffer is a bytes.Buffer safe for the concurrent writes of the handler.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// execute runs yc with args against the fake zipper and returns its output.
+func execute(t *testing.T, s *fake.Server, args ...string) string {
+	t.Helper()
+	return executeWithConfig(t, s, "", args...)
+}
+
+// executeWithConfig runs yc like execute, with config as yc.yml.
+func executeWithConfig(t *testing.T, s *fake.Server, config string, args ...string) string {
+	t.Helper()
+
+	configFile := ""
+	if config != "" {
+		configFile = filepath.Join(t.TempDir(), "yc.yml")
+		if err := os.WriteFile(configFile, []byte(config), 0644); err != nil {
+			t.Fatalf("Failed to create file %s: %v", configFile, err)
+		}
+	}
+
+	rootCmd := &cobra.Command{Use: "yc"}
+	out := &syncBuffer{}
+	rootCmd.SetOut(out)
+	rootCmd.SetArgs(append([]string{"--secret", "test", "--tool", "test_tool"}, args...))
+
+	tid := strings.ReplaceAll(t.Name(), "/", "_") + args[0]
+	if err := pkg.Execute(rootCmd, configFile, tid, s.Addr(), uint32(len(s.Zones()))); err != nil {
+		t.Fatalf("Execute(%v) failed: %v", args, err)
+	}
+	return out.String()
+}
+
+func startFake(t *testing.T, cfg fake.Config) *fake.Server {
+	t.Helper()
+
+	// the handshake is cached per zipper, and the fakes may reuse a port
+	t.Setenv("YC_CACHE_DIR", t.TempDir())
+
+	cfg.Addr = "localhost:0"
+	s, err := fake.Start(cfg)
+	if err != nil {
+		t.Fatalf("Failed to start fake zipper: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+// withoutHandshake drops the hello and mesh discovery requests sent before
+// each command.
+func withoutHandshake(requests []fake.Request) []fake.Request {
+	var filtered []fake.Request
+	for _, r := range requests {
+		if r.Tag != pkg.TAG_REQUEST_HELLO && r.Tag != pkg.TAG_REQUEST_MESH {
+			filtered = append(filtered, r)
+		}
+	}
+	return filtered
+}
+
+func TestCommandsWithFakeZipper(t *testing.T) {
+	s := startFake(t, fake.Config{
+		Zones: []fake.Zone{
+			{Name: "zone-a"},
+			{Name: "zone-b", Latency: 100 * time.Millisecond},
+		},
+		LogsDone: true,
+	})
+
+	src := filepath.Join(t.TempDir(), "app.go")
+	if err := os.WriteFile(src, []byte("package main\n"), 0644); err != nil {
+		t.Fatalf("Failed to create file %s: %v", src, err)
+	}
+
+	tests := []struct {
+		args     []string
+		expected []string
+	}{
+		{[]string{"upload", src}, []string{"OK: uploaded"}},
+		{[]string{"create", "--env", "KEY=value"}, []string{"[zone-a] OK: created test_tool", "[zone-b] OK: created test_tool"}},
+		{[]string{"status"}, []string{"[zone-a] OK: test_tool is running", "[zone-b] OK: test_tool is running"}},
+		{[]string{"logs"}, []string{" zone-a zone-a-1 INFO  out test_tool log line 1", " zone-b zone-b-1 ERROR err test_tool log line 3"}},
+		{[]string{"describe"}, []string{"Tool: test_tool", "Description: test_tool fake tool", `"type": "object"`}},
+		{[]string{"invoke", "--args", `{"city": "Paris"}`}, []string{"[zone-a] OK (", `): test_tool called with {"city":"Paris"}`}},
+		{[]string{"remove"}, []string{"[zone-a] OK: removed test_tool", "[zone-b] OK: removed test_tool"}},
+	}
+
+	for _, tt := range tests {
+		out := execute(t, s, tt.args...)
+		for _, expected := range tt.expected {
+			if !strings.Contains(out, expected) {
+				t.Errorf("yc %s output %q does not contain %q", tt.args[0], out, expected)
+			}
+		}
+	}
+
+	// invoke describes the tool before calling it
+	requests := withoutHandshake(s.Requests())
+	if len(requests) != len(tests)+1 {
+		t.Fatalf("Expected %d requests, got %d", len(tests)+1, len(requests))
+	}
+	for _, r := range requests {
+		if r.SfnName != "test_tool" || r.Version != pkg.SpecVersion {
+			t.Errorf("Unexpected request envelope %+v", r)
+		}
+	}
+
+	var create pkg.ReqMsgCreate
+	if err := json.Unmarshal(requests[1].Msg, &create); err != nil {
+		t.Fatalf("Failed to decode create request: %v", err)
+	}
+	if create.Envs == nil || len(*create.Envs) != 1 || (*create.Envs)[0] != "KEY=value" {
+		t.Errorf("Unexpected create envs %v", create.Envs)
+	}
+}
+
+func TestCommandsWithFailingZone(t *testing.T) {
+	s := startFake(t, fake.Config{
+		Zones: []fake.Zone{
+			{Name: "zone-a"},
+			{Name: "zone-b", Failures: map[uint32]string{pkg.TAG_REQUEST_STATUS: "not deployed"}},
+		},
+	})
+
+	out := execute(t, s, "status")
+	if !strings.Contains(out, "[zone-b] Error: not deployed") {
+		t.Errorf("Expected zone-b error in output %q", out)
+	}
+}
+
+func TestInvokeTimeout(t *testing.T) {
+	s := startFake(t, fake.Config{
+		Zones: []fake.Zone{
+			{Name: "zone-a"},
+			{Name: "zone-b", Latency: time.Second},
+		},
+	})
+
+	out := execute(t, s, "invoke", "--timeout", "300ms")
+	if !strings.Contains(out, "[zone-a] OK (") {
+		t.Errorf("Expected zone-a result in output %q", out)
+	}
+	if !strings.Contains(out, "Error: timed out after 300ms, 1 of 2 zones responded") {
+		t.Errorf("Expected timeout error in output %q", out)
+	}
+}
+
+func TestInvokeValidatesArgs(t *testing.T) {
+	schema := `{"type":"object","properties":{"city":{"type":"string"},"days":{"type":"integer"}},"required":["city"]}`
+	desc, _ := json.Marshal(pkg.ResMsgDescribe{Description: "weather", InputSchema: json.RawMessage(schema)})
+	s := startFake(t, fake.Config{
+		Zones: []fake.Zone{
+			{Name: "zone-a", Responses: map[uint32]string{pkg.TAG_REQUEST_DESCRIBE: string(desc)}},
+		},
+	})
+
+	out := execute(t, s, "invoke", "--args", `{"city": "Paris", "days": 3}`)
+	if !strings.Contains(out, `[zone-a] OK (`) {
+		t.Errorf("Expected zone-a result in output %q", out)
+	}
+
+	requests := withoutHandshake(s.Requests())
+	if len(requests) != 2 || requests[0].Tag != pkg.TAG_REQUEST_DESCRIBE || requests[1].Tag != pkg.TAG_REQUEST_INVOKE {
+		t.Fatalf("Expected describe then invoke requests, got %+v", requests)
+	}
+}
+
+func TestVersionShowsServerVersion(t *testing.T) {
+	s := startFake(t, fake.Config{Zones: []fake.Zone{{Name: "zone-a"}}})
+
+	out := execute(t, s, "version")
+	if strings.Contains(out, "server version") || len(s.Requests()) != 0 {
+		t.Errorf("Expected yc version to work offline, got %q and %d requests", out, len(s.Requests()))
+	}
+
+	out = execute(t, s, "version", "--server")
+	for _, expected := range []string{
+		"version: " + pkg.CliVersion,
+		"server version: " + fake.ServerVersion,
+		"server spec versions: [2] (using 2)",
+	} {
+		if !strings.Contains(out, expected) {
+			t.Errorf("yc version output %q does not contain %q", out, expected)
+		}
+	}
+}
+
+func TestUploadExplain(t *testing.T) {
+	s := startFake(t, fake.Config{Zones: []fake.Zone{{Name: "zone-a"}}})
+
+	src := t.TempDir()
+	for name, content := range map[string]string{"app.go": "package main\n", ".env": "SECRET=1\n"} {
+		if err := os.WriteFile(filepath.Join(src, name), []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to create file: %v", err)
+		}
+	}
+
+	out := execute(t, s, "upload", src, "--explain")
+	for _, expected := range []string{"included  app.go", "excluded  .env"} {
+		if !strings.Contains(out, expected) {
+			t.Errorf("yc upload --explain output %q does not contain %q", out, expected)
+		}
+	}
+}
+
+func TestUploadIsFramed(t *testing.T) {
+	s := startFake(t, fake.Config{Zones: []fake.Zone{{Name: "zone-a"}}})
+
+	// random content doesn't deflate, so the archive is larger than the
+	// compression threshold
+	content := make([]byte, 8<<10)
+	rand.Read(content)
+	src := t.TempDir()
+	if err := os.WriteFile(filepath.Join(src, "data.bin"), content, 0644); err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+
+	out := execute(t, s, "upload", src)
+	if !strings.Contains(out, "[zone-a] OK: uploaded") {
+		t.Errorf("Expected upload result in output %q", out)
+	}
+
+	requests := withoutHandshake(s.Requests())
+	if len(requests) != 1 {
+		t.Fatalf("Expected an upload request, got %d requests", len(requests))
+	}
+	upload := requests[0]
+	if len(upload.Body) <= len(content) || upload.Compressed {
+		t.Errorf("Expected the archive as an uncompressed frame body, got %d bytes, compressed %v", len(upload.Body), upload.Compressed)
+	}
+	if !strings.Contains(string(upload.Msg), `"zip_data":null`) {
+		t.Errorf("Expected the archive out of the header, got %s", upload.Msg)
+	}
+}
+
+func TestLargeRequestsAreCompressed(t *testing.T) {
+	s := startFake(t, fake.Config{Zones: []fake.Zone{{Name: "zone-a"}}})
+
+	args := `{"text": "` + strings.Repeat("lorem ipsum ", 1000) + `"}`
+	execute(t, s, "invoke", "--no-validate", "--args", args)
+
+	requests := withoutHandshake(s.Requests())
+	if len(requests) != 1 || !requests[0].Compressed {
+		t.Fatalf("Expected a compressed invoke request, got %d requests", len(requests))
+	}
+}
+
+func TestDoctor(t *testing.T) {
+	s := startFake(t, fake.Config{Zones: []fake.Zone{{Name: "zone-a"}}})
+
+	out := execute(t, s, "doctor")
+	for _, expected := range []string{
+		"[ OK ] dns",
+		"[ OK ] udp reachability",
+		"[ OK ] quic/tls handshake",
+		"[ OK ] credential",
+		"[ OK ] server handshake     server fake in zone-a",
+		"[ OK ] spec version",
+		"[ OK ] clock skew",
+		"All checks passed",
+	} {
+		if !strings.Contains(out, expected) {
+			t.Errorf("yc doctor output %q does not contain %q", out, expected)
+		}
+	}
+}
+
+func TestDebugLogsRedactedPayloads(t *testing.T) {
+	s := startFake(t, fake.Config{Zones: []fake.Zone{{Name: "zone-a"}}})
+	logFile := filepath.Join(t.TempDir(), "yc.log")
+
+	execute(t, s, "create", "--env", "API_KEY=sup3r", "--debug", "--log-file", logFile)
+
+	data, err := os.ReadFile(logFile)
+	if err != nil {
+		t.Fatalf("Failed to read file %s: %v", logFile, err)
+	}
+	logs := string(data)
+	for _, expected := range []string{
+		`msg=send tag="create request (0xe202)"`,
+		`msg=receive tag="create response (0xf202)" zone=zone-a done=true`,
+		`API_KEY=<redacted>`,
+	} {
+		if !strings.Contains(logs, expected) {
+			t.Errorf("Debug logs %q do not contain %q", logs, expected)
+		}
+	}
+	if strings.Contains(logs, "sup3r") {
+		t.Errorf("Debug logs %q contain the secret environment variable value", logs)
+	}
+}
+
+func TestMultipleTools(t *testing.T) {
+	s := startFake(t, fake.Config{Zones: []fake.Zone{{Name: "zone-a"}, {Name: "zone-b"}}})
+
+	dir := t.TempDir()
+	for _, name := range []string{"weather", "search"} {
+		src := filepath.Join(dir, name, "app.go")
+		os.MkdirAll(filepath.Dir(src), 0755)
+		if err := os.WriteFile(src, []byte("package main\n"), 0644); err != nil {
+			t.Fatalf("Failed to create file %s: %v", src, err)
+		}
+	}
+	config := fmt.Sprintf(`tools:
+  - name: weather
+    src: %s
+    envs: ["UNITS=metric"]
+  - name: search
+    src: %s
+`, filepath.Join(dir, "weather"), filepath.Join(dir, "search"))
+
+	out := executeWithConfig(t, s, config, "deploy", "--all", "--env", "REGION=eu")
+	for _, expected := range []string{
+		"weather: [zone-a] OK: uploaded",
+		"search: [zone-b] OK: created search",
+		"TOOL     ZONE    STATUS  MESSAGE",
+		"weather  zone-a  OK      created weather",
+		"search   zone-b  OK      created search",
+	} {
+		if !strings.Contains(out, expected) {
+			t.Errorf("yc deploy --all output %q does not contain %q", out, expected)
+		}
+	}
+
+	for _, r := range withoutHandshake(s.Requests()) {
+		if r.Tag != pkg.TAG_REQUEST_CREATE || r.SfnName != "weather" {
+			continue
+		}
+		var create pkg.ReqMsgCreate
+		json.Unmarshal(r.Msg, &create)
+		if create.Envs == nil || strings.Join(*create.Envs, " ") != "UNITS=metric REGION=eu" {
+			t.Errorf("Unexpected create envs of weather %v", create.Envs)
+		}
+	}
+
+	out = executeWithConfig(t, s, config, "status", "--tool", "weather,other")
+	for _, expected := range []string{
+		"weather  zone-a  OK      weather is running",
+		"other    zone-b  OK      other is running",
+	} {
+		if !strings.Contains(out, expected) {
+			t.Errorf("yc status --tool weather,other output %q does not contain %q", out, expected)
+		}
+	}
+}
+
+func TestList(t *testing.T) {
+	s := startFake(t, fake.Config{Zones: []fake.Zone{{Name: "zone-a"}, {Name: "zone-b"}}})
+
+	if out := execute(t, s, "list"); !strings.Contains(out, "No tools deployed") {
+		t.Errorf("yc list output %q does not contain %q", out, "No tools deployed")
+	}
+
+	src := filepath.Join(t.TempDir(), "app.go")
+	if err := os.WriteFile(src, []byte("package main\n"), 0644); err != nil {
+		t.Fatalf("Failed to create file %s: %v", src, err)
+	}
+	execute(t, s, "deploy", src)
+	execute(t, s, "deploy", src)
+
+	out := execute(t, s, "list")
+	for _, expected := range []string{
+		"TOOL       ZONE    STATUS   VERSION  DEPLOYED",
+		"test_tool  zone-a  running  v2       " + time.Now().Format("2006-01-02"),
+		"test_tool  zone-b  running  v2",
+	} {
+		if !strings.Contains(out, expected) {
+			t.Errorf("yc list output %q does not contain %q", out, expected)
+		}
+	}
+}
+
+func TestListIgnoresProgress(t *testing.T) {
+	progress := map[uint32][]string{pkg.TAG_REQUEST_LIST: {"listing", "still listing"}}
+	s := startFake(t, fake.Config{Zones: []fake.Zone{
+		{Name: "zone-a", Progress: progress},
+		{Name: "zone-b", Progress: progress},
+	}})
+
+	out := execute(t, s, "list")
+	if !strings.Contains(out, "No tools deployed") || strings.Contains(out, "Error") || strings.Contains(out, "Warning") {
+		t.Errorf("Expected the progress messages to be ignored, got %q", out)
+	}
+}
+
+func TestZoneSelection(t *testing.T) {
+	s := startFake(t, fake.Config{Zones: []fake.Zone{{Name: "zone-a"}, {Name: "zone-b"}, {Name: "zone-c"}}})
+
+	start := time.Now()
+	out := execute(t, s, "status", "--zone", "zone-b", "--zone", "zone-c")
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("yc status --zone waited %s for unselected zones", elapsed)
+	}
+	for _, expected := range []string{"[zone-b] OK: test_tool is running", "[zone-c] OK: test_tool is running"} {
+		if !strings.Contains(out, expected) {
+			t.Errorf("yc status --zone output %q does not contain %q", out, expected)
+		}
+	}
+	if strings.Contains(out, "zone-a") {
+		t.Errorf("yc status --zone output %q contains the unselected zone-a", out)
+	}
+
+	requests := withoutHandshake(s.Requests())
+	if len(requests) != 1 || strings.Join(requests[0].Zones, ",") != "zone-b,zone-c" {
+		t.Errorf("Unexpected requests %+v", requests)
+	}
+}
+
+func TestMeshDiscovery(t *testing.T) {
+	s := startFake(t, fake.Config{Zones: []fake.Zone{
+		{Name: "zone-a", Region: "us-east"},
+		{Name: "zone-b", Region: "eu-west", Down: true},
+		{Name: "zone-c", Region: "ap-southeast"},
+	}})
+
+	out := execute(t, s, "zones")
+	for _, expected := range []string{
+		"ZONE    REGION        HEALTH",
+		"zone-a  us-east       healthy",
+		"zone-b  eu-west       down",
+	} {
+		if !strings.Contains(out, expected) {
+			t.Errorf("yc zones output %q does not contain %q", out, expected)
+		}
+	}
+
+	// the zone down is not waited for, although the mesh size defaults to 3 zones
+	start := time.Now()
+	out = execute(t, s, "status")
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("yc status waited %s for the zone down", elapsed)
+	}
+	if !strings.Contains(out, "[zone-c] OK: test_tool is running") {
+		t.Errorf("yc status output %q does not contain the zone-c status", out)
+	}
+}
+
+func TestLogsJSONOutput(t *testing.T) {
+	s := startFake(t, fake.Config{Zones: []fake.Zone{{Name: "zone-a"}}, LogsDone: true})
+
+	out := execute(t, s, "logs", "--output", "json")
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("Expected 3 log lines, got %q", out)
+	}
+	levels := map[string]string{}
+	for _, line := range lines {
+		var record struct {
+			Time     time.Time `json:"time"`
+			Zone     string    `json:"zone"`
+			Instance string    `json:"instance"`
+			Level    string    `json:"level"`
+			Stream   string    `json:"stream"`
+			Message  string    `json:"message"`
+		}
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("Failed to decode log line %q: %v", line, err)
+		}
+		if record.Zone != "zone-a" || record.Instance != "zone-a-1" || record.Time.IsZero() {
+			t.Errorf("Unexpected log record %+v", record)
+		}
+		levels[record.Message] = record.Level + "/" + record.Stream
+	}
+	if levels["test_tool log line 3"] != "error/stderr" {
+		t.Errorf("Unexpected log levels %v", levels)
+	}
+}
+
+func TestLogsInstances(t *testing.T) {
+	s := startFake(t, fake.Config{Zones: []fake.Zone{{Name: "zone-a", Instances: 2}}, LogsDone: true})
+
+	// both instances count their lines from 1, none is a replay
+	out := execute(t, s, "logs", "--output", "json")
+	for _, instance := range []string{"zone-a-1", "zone-a-2"} {
+		for i := 1; i <= 3; i++ {
+			message := fmt.Sprintf("test_tool log line %d of %s", i, instance)
+			if !strings.Contains(out, message) {
+				t.Errorf("yc logs output %q does not contain line %d of %s", out, i, instance)
+			}
+		}
+	}
+	if n := strings.Count(strings.TrimSpace(out), "\n") + 1; n != 6 {
+		t.Errorf("Expected 6 log lines, got %d in %q", n, out)
+	}
+}
+
+func TestLogsTimeRange(t *testing.T) {
+	// the lines of the fake are written a minute apart, the last one now
+	s := startFake(t, fake.Config{Zones: []fake.Zone{{Name: "zone-a"}}})
+
+	out := execute(t, s, "logs", "--since", "90s", "--no-follow")
+	if strings.Contains(out, "log line 1") || !strings.Contains(out, "log line 2") || !strings.Contains(out, "log line 3") {
+		t.Errorf("Expected the lines since 90s ago, got %q", out)
+	}
+
+	out = execute(t, s, "logs", "--until", "30s")
+	if !strings.Contains(out, "log line 1") || !strings.Contains(out, "log line 2") || strings.Contains(out, "log line 3") {
+		t.Errorf("Expected the lines until 30s ago, got %q", out)
+	}
+
+	requests := withoutHandshake(s.Requests())
+	if len(requests) != 2 {
+		t.Fatalf("Expected 2 requests, got %d", len(requests))
+	}
+	var req pkg.ReqMsgLogs
+	if err := json.Unmarshal(requests[1].Msg, &req); err != nil {
+		t.Fatalf("Failed to decode logs request: %v", err)
+	}
+	if !req.NoFollow || !req.Since.IsZero() || req.Until.IsZero() {
+		t.Errorf("Unexpected logs request %+v", req)
+	}
+
+	dir := t.TempDir()
+	out = execute(t, s, "logs", "--no-follow", "--save", dir)
+	if strings.Contains(out, "log line") {
+		t.Errorf("Expected the lines in the files only, got %q", out)
+	}
+	buf, err := os.ReadFile(filepath.Join(dir, "test_tool-zone-a.log"))
+	if err != nil {
+		t.Fatalf("Failed to read the saved logs: %v", err)
+	}
+	if n := strings.Count(string(buf), "log line"); n != 3 {
+		t.Errorf("Expected 3 saved lines, got %q", buf)
+	}
+
+	// a server which doesn't end the stream doesn't hang the download
+	slow := startFake(t, fake.Config{Zones: []fake.Zone{{Name: "zone-a"}}, IgnoreNoFollow: true})
+	start := time.Now()
+	out = execute(t, slow, "logs", "--no-follow", "--timeout", "300ms")
+	if !strings.Contains(out, "Error: timed out after 300ms, 0 of 1 zones responded") {
+		t.Errorf("Expected the download to time out, got %q", out)
+	}
+	if elapsed := time.Since(start); elapsed > 3*time.Second {
+		t.Errorf("Expected yc logs to give up after --timeout, took %s", elapsed)
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	s := startFake(t, fake.Config{Zones: []fake.Zone{
+		{Name: "zone-a"},
+		{Name: "zone-b", Failures: map[uint32]string{pkg.TAG_REQUEST_METRICS: "tool not deployed"}},
+	}})
+
+	out := execute(t, s, "metrics", "--since", "2h")
+	for _, expected := range []string{
+		"ZONE    INVOCATIONS  ERRORS    P50   P95   P99     MEMORY    CPU",
+		"zone-a  465          6 (1.3%)  12ms  48ms  95.5ms  64.0 MiB  12.5%",
+		"[zone-b] Error: tool not deployed",
+	} {
+		if !strings.Contains(out, expected) {
+			t.Errorf("yc metrics output %q does not contain %q", out, expected)
+		}
+	}
+
+	out = execute(t, s, "metrics", "--output", "chart")
+	for _, expected := range []string{"zone-a\n", "  invocations  ▁▁▂▂▂▂▃▃▃▃▄▄▄▄▅▅▅▅▅▆▆▆▆▇▇▇▇███  465"} {
+		if !strings.Contains(out, expected) {
+			t.Errorf("yc metrics --output chart output %q does not contain %q", out, expected)
+		}
+	}
+
+	out = execute(t, s, "metrics", "--output", "json", "--zone", "zone-a")
+	var metrics struct {
+		Since time.Time `json:"since"`
+		Until time.Time `json:"until"`
+		Zones []struct {
+			Zone string `json:"zone"`
+			pkg.ResMsgMetrics
+		} `json:"zones"`
+	}
+	if err := json.Unmarshal([]byte(out), &metrics); err != nil {
+		t.Fatalf("Failed to decode %q: %v", out, err)
+	}
+	if len(metrics.Zones) != 1 || metrics.Zones[0].Zone != "zone-a" || len(metrics.Zones[0].Series) != 30 {
+		t.Errorf("Unexpected metrics %+v", metrics)
+	}
+	if d := metrics.Until.Sub(metrics.Since); d != time.Hour {
+		t.Errorf("Expected a window of 1h by default, got %s", d)
+	}
+}
+
+// collector is an OTLP/HTTP collector stand-in, recording the spans of yc.
+type collector struct {
+	mu    sync.Mutex
+	spans map[string][]*tracepb.Span
+}
+
+func (c *collector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	var req coltracepb.ExportTraceServiceRequest
+	if err := proto.Unmarshal(body, &req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, rs := range req.ResourceSpans {
+		for _, ss := range rs.ScopeSpans {
+			if ss.Scope.GetName() != "github.com/vivgrid/yc" {
+				continue
+			}
+			for _, span := range ss.Spans {
+				c.spans[span.Name] = append(c.spans[span.Name], span)
+			}
+		}
+	}
+	buf, _ := proto.Marshal(&coltracepb.ExportTraceServiceResponse{})
+	w.Header().Set("Content-Type", "application/x-protobuf")
+	w.Write(buf)
+}
+
+func TestTracing(t *testing.T) {
+	s := startFake(t, fake.Config{Zones: []fake.Zone{{Name: "zone-a"}, {Name: "zone-b"}}})
+	c := &collector{spans: make(map[string][]*tracepb.Span)}
+	otlp := httptest.NewServer(c)
+	defer otlp.Close()
+	t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", otlp.URL)
+
+	src := filepath.Join(t.TempDir(), "app.go")
+	if err := os.WriteFile(src, []byte("package main\n"), 0644); err != nil {
+		t.Fatalf("Failed to create file %s: %v", src, err)
+	}
+	execute(t, s, "deploy", src)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	root := c.spans["yc deploy"]
+	if len(root) != 1 {
+		t.Fatalf("Expected the yc deploy span, got spans %v", slices.Collect(maps.Keys(c.spans)))
+	}
+	parentOf := func(name string) []byte {
+		spans := c.spans[name]
+		if len(spans) == 0 {
+			t.Fatalf("Missing %s span", name)
+		}
+		return spans[0].ParentSpanId
+	}
+	for _, name := range []string{"upload", "remove", "create"} {
+		if !bytes.Equal(parentOf(name), root[0].SpanId) {
+			t.Errorf("Expected the %s span to be a child of the yc deploy span", name)
+		}
+	}
+	if !bytes.Equal(parentOf("package"), c.spans["upload"][0].SpanId) {
+		t.Error("Expected the package span to be a child of the upload span")
+	}
+
+	zones := map[string]int{}
+	for _, span := range c.spans["response"] {
+		for _, attr := range span.Attributes {
+			if attr.Key == "yc.zone" {
+				zones[attr.Value.GetStringValue()]++
+			}
+		}
+	}
+	// remove and create are answered by both zones, upload by the first one
+	if zones["zone-a"]+zones["zone-b"] < 5 || zones["zone-a"] < 2 || zones["zone-b"] < 2 {
+		t.Errorf("Unexpected response spans per zone %v", zones)
+	}
+}
+
+func TestTrace(t *testing.T) {
+	s := startFake(t, fake.Config{Zones: []fake.Zone{{Name: "zone-a"}, {Name: "zone-b"}}})
+
+	out := execute(t, s, "trace", "--last", "3")
+	if n := strings.Count(out, "time by service: test_tool 100ms, zipper 20ms"); n != 3 {
+		t.Errorf("Expected the 3 last traces, got %d in %q", n, out)
+	}
+	for _, expected := range []string{
+		"zone-b-req-3 in zone-b at ",
+		"  invoke        zipper     |████████████████████████████████████████|  120ms",
+		"      llm call  test_tool  |      ██████████████████████████        |  80ms",
+	} {
+		if !strings.Contains(out, expected) {
+			t.Errorf("yc trace output %q does not contain %q", out, expected)
+		}
+	}
+
+	out = execute(t, s, "trace", "req-42", "--zone", "zone-a", "--output", "otlp")
+	var otlp struct {
+		ResourceSpans []struct {
+			Resource struct {
+				Attributes []struct {
+					Key   string `json:"key"`
+					Value struct {
+						StringValue string `json:"stringValue"`
+					} `json:"value"`
+				} `json:"attributes"`
+			} `json:"resource"`
+			ScopeSpans []struct {
+				Spans []struct {
+					TraceID string `json:"traceId"`
+					Name    string `json:"name"`
+				} `json:"spans"`
+			} `json:"scopeSpans"`
+		} `json:"resourceSpans"`
+	}
+	if err := json.Unmarshal([]byte(out), &otlp); err != nil {
+		t.Fatalf("Failed to decode %q: %v", out, err)
+	}
+	var names []string
+	for _, rs := range otlp.ResourceSpans {
+		for _, span := range rs.ScopeSpans[0].Spans {
+			names = append(names, rs.Resource.Attributes[0].Value.StringValue+"/"+span.Name)
+		}
+	}
+	if strings.Join(names, " ") != "zipper/invoke zipper/route test_tool/handler test_tool/llm call" {
+		t.Errorf("Unexpected OTLP spans %q", names)
+	}
+
+	var req pkg.ReqMsgTrace
+	requests := withoutHandshake(s.Requests())
+	if err := json.Unmarshal(requests[len(requests)-1].Msg, &req); err != nil {
+		t.Fatalf("Failed to decode trace request: %v", err)
+	}
+	if req.RequestID != "req-42" {
+		t.Errorf("Unexpected trace request %+v", req)
+	}
+}
+
+func TestVersionWithUnreachableServer(t *testing.T) {
+	s := startFake(t, fake.Config{Zones: []fake.Zone{{Name: "zone-a"}}, NoHello: true})
+
+	out := execute(t, s, "version", "--server")
+	for _, expected := range []string{"version: " + pkg.CliVersion, "server version: unknown, timed out"} {
+		if !strings.Contains(out, expected) {
+			t.Errorf("yc version --server output %q does not contain %q", out, expected)
+		}
+	}
+}
+
+func TestHandshakeIsCached(t *testing.T) {
+	countHellos := func(s *fake.Server) int {
+		n := 0
+		for _, r := range s.Requests() {
+			if r.Tag == pkg.TAG_REQUEST_HELLO {
+				n++
+			}
+		}
+		return n
+	}
+
+	s := startFake(t, fake.Config{Zones: []fake.Zone{{Name: "zone-a"}}})
+	execute(t, s, "status")
+	execute(t, s, "status")
+	if n := countHellos(s); n != 1 {
+		t.Errorf("Expected a single hello for 2 commands, got %d", n)
+	}
+
+	// a missing answer is cached too, only the first command waits for it
+	s = startFake(t, fake.Config{Zones: []fake.Zone{{Name: "zone-a"}}, NoHello: true})
+	execute(t, s, "status")
+	start := time.Now()
+	out := execute(t, s, "status")
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("Expected the missing hello to be cached, the command took %s", elapsed)
+	}
+	if !strings.Contains(out, "[zone-a] OK: test_tool is running") {
+		t.Errorf("yc status output %q does not contain the status", out)
+	}
+	if n := countHellos(s); n != 1 {
+		t.Errorf("Expected a single hello for 2 commands, got %d", n)
+	}
+}
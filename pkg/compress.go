@@ -0,0 +1,85 @@
+package pkg
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"slices"
+)
+
+// Encoding is a payload compression, negotiated in the hello handshake.
+type Encoding string
+
+const EncodingGzip Encoding = "gzip"
+
+// supportedEncodings lists the encodings of this CLI, by preference.
+var supportedEncodings = []Encoding{EncodingGzip}
+
+const (
+	// compressMinSize is the payload size from which compression pays off.
+	compressMinSize = 1 << 10
+	// maxDecodedPayloadSize bounds decompressed payloads.
+	maxDecodedPayloadSize = 1 << 30
+)
+
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// pickEncoding returns the first supported encoding also offered by the
+// peer, or an empty Encoding to send payloads as-is.
+func pickEncoding(offered []Encoding) Encoding {
+	for _, enc := range supportedEncodings {
+		if slices.Contains(offered, enc) {
+			return enc
+		}
+	}
+	return ""
+}
+
+// EncodePayload compresses a JSON payload with enc. Payloads smaller than
+// compressMinSize are returned as-is, as is everything with no encoding.
+// Frames of FramedCodec are not compressed either, their binary body is
+// typically a compressed archive already.
+func EncodePayload(data []byte, enc Encoding) ([]byte, error) {
+	if enc == "" || len(data) < compressMinSize || isFrame(data) {
+		return data, nil
+	}
+
+	switch enc {
+	case EncodingGzip:
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		if _, err := zw.Write(data); err != nil {
+			return nil, err
+		}
+		if err := zw.Close(); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	default:
+		return nil, fmt.Errorf("unsupported encoding %q", enc)
+	}
+}
+
+// DecodePayload decompresses a payload made by EncodePayload. Compressed
+// payloads are recognized by their magic number, JSON ones are returned as-is.
+func DecodePayload(data []byte) ([]byte, error) {
+	if !bytes.HasPrefix(data, gzipMagic) {
+		return data, nil
+	}
+
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+
+	decoded, err := io.ReadAll(io.LimitReader(zr, maxDecodedPayloadSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(decoded) > maxDecodedPayloadSize {
+		return nil, fmt.Errorf("decompressed payload exceeds %s", formatSize(maxDecodedPayloadSize))
+	}
+	return decoded, nil
+}
@@ -0,0 +1,56 @@
+package pkg
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestEncodePayload(t *testing.T) {
+	large := []byte(`{"msg":"` + string(bytes.Repeat([]byte("log line "), 1000)) + `"}`)
+	small := []byte(`{"msg":"hi"}`)
+
+	tests := []struct {
+		name       string
+		data       []byte
+		enc        Encoding
+		compressed bool
+	}{
+		{"large gzip", large, EncodingGzip, true},
+		{"small gzip", small, EncodingGzip, false},
+		{"large plain", large, "", false},
+	}
+
+	for _, tt := range tests {
+		encoded, err := EncodePayload(tt.data, tt.enc)
+		if err != nil {
+			t.Fatalf("%s: EncodePayload failed: %v", tt.name, err)
+		}
+		if compressed := !bytes.Equal(encoded, tt.data); compressed != tt.compressed {
+			t.Errorf("%s: compressed = %v, want %v", tt.name, compressed, tt.compressed)
+		}
+		if tt.compressed && len(encoded) >= len(tt.data) {
+			t.Errorf("%s: compressed payload is %d bytes, original %d", tt.name, len(encoded), len(tt.data))
+		}
+
+		decoded, err := DecodePayload(encoded)
+		if err != nil {
+			t.Fatalf("%s: DecodePayload failed: %v", tt.name, err)
+		}
+		if !bytes.Equal(decoded, tt.data) {
+			t.Errorf("%s: round trip changed the payload", tt.name)
+		}
+	}
+
+	if _, err := EncodePayload(large, "br"); err == nil {
+		t.Error("Expected error for an unsupported encoding")
+	}
+}
+
+func TestPickEncoding(t *testing.T) {
+	if enc := pickEncoding([]Encoding{"br", EncodingGzip}); enc != EncodingGzip {
+		t.Errorf("pickEncoding() = %q, want %q", enc, EncodingGzip)
+	}
+	if enc := pickEncoding(nil); enc != "" {
+		t.Errorf("pickEncoding(nil) = %q, want none", enc)
+	}
+}
@@ -1,12 +1,18 @@
 package pkg
 
-import "time"
+import (
+	"encoding/json"
+	"time"
+)
 
+// Request is the envelope of every request. Only the Zones of the mesh act
+// on it when set, every zone otherwise.
 type Request[T any] struct {
-	Version uint32 `json:"version"`
-	Target  string `json:"target"`
-	SfnName string `json:"sfn_name"`
-	Msg     *T     `json:"msg"`
+	Version uint32   `json:"version"`
+	Target  string   `json:"target"`
+	SfnName string   `json:"sfn_name"`
+	Zones   []string `json:"zones,omitempty"`
+	Msg     *T       `json:"msg"`
 }
 
 type Response struct {
@@ -16,9 +22,40 @@ type Response struct {
 	Msg      string `json:"msg"`
 }
 
+// ReqMsgHello announces the spec versions spoken by the CLI, the payload
+// encodings it accepts in responses and the codecs it can send requests with.
+type ReqMsgHello struct {
+	CliVersion   string     `json:"cli_version"`
+	SpecVersions []uint32   `json:"spec_versions"`
+	Encodings    []Encoding `json:"encodings"`
+	Codecs       []string   `json:"codecs"`
+}
+
+// ResMsgHello is carried JSON encoded in the response Msg. It announces the
+// spec versions spoken by the server, the oldest CLI version it accepts and
+// the requests, payload encodings and request codecs it supports, along with
+// its clock.
+type ResMsgHello struct {
+	ServerVersion string     `json:"server_version"`
+	SpecVersions  []uint32   `json:"spec_versions"`
+	MinCliVersion string     `json:"min_cli_version"`
+	Capabilities  []string   `json:"capabilities"`
+	Encodings     []Encoding `json:"encodings"`
+	Codecs        []string   `json:"codecs"`
+	ServerTime    time.Time  `json:"server_time"`
+}
+
 type ReqMsgUpload struct {
-	ZipData []byte `json:"zip_data"`
+	ZipData []byte  `json:"zip_data"`
+	Runtime Runtime `json:"runtime"`
 }
+
+// Body implements BinaryMessage, the archive is sent as the frame body.
+func (m *ReqMsgUpload) Body() []byte { return m.ZipData }
+
+// SetBody implements BinaryMessage.
+func (m *ReqMsgUpload) SetBody(body []byte) { m.ZipData = body }
+
 type ResMsgUpload struct {
 	Log string `json:"log"`
 }
@@ -37,22 +74,182 @@ type ResMsgStatus struct {
 	StartedAt time.Time `json:"started_at"`
 }
 
-type ReqMsgLogs = struct{}
-type ResMsgLogs = struct {
-	Log string `json:"log"`
+// ReqMsgLogs asks for log lines, sent as ResMsgLogs when Structured is set
+// and as plain text in the response Msg otherwise. Cursors holds the Seq of
+// the last line received from each instance, keyed by zone and instance, the
+// instances resume after it instead of sending the tail again. Since and Until select the lines written in that
+// range instead of the tail, and NoFollow ends the stream with a Done
+// response once the lines are sent.
+type ReqMsgLogs struct {
+	Structured bool                         `json:"structured"`
+	Cursors    map[string]map[string]uint64 `json:"cursors,omitempty"`
+	Since      time.Time                    `json:"since,omitzero"`
+	Until      time.Time                    `json:"until,omitzero"`
+	NoFollow   bool                         `json:"no_follow,omitempty"`
+}
+
+// ResMsgLogs is a log line carried JSON encoded in the response Msg, written
+// at Time by an Instance of the tool on Stream, one of LogStdout or LogStderr.
+// Seq increases with each line of the Instance and counts from 1 again when
+// it restarts, it is 0 when not tracked.
+type ResMsgLogs struct {
+	Seq      uint64    `json:"seq"`
+	Log      string    `json:"log"`
+	Time     time.Time `json:"time"`
+	Instance string    `json:"instance"`
+	Level    string    `json:"level"`
+	Stream   string    `json:"stream"`
+}
+
+const (
+	LogStdout = "stdout"
+	LogStderr = "stderr"
+)
+
+// ReqMsgInvoke calls the tool with Args, the JSON arguments of the function
+// call. Each zone answers with the tool result in the response Msg.
+type ReqMsgInvoke struct {
+	Args json.RawMessage `json:"args"`
+}
+type ResMsgInvoke struct{}
+
+type ReqMsgDescribe struct{}
+
+// ResMsgDescribe is carried JSON encoded in the response Msg.
+type ResMsgDescribe struct {
+	Description string          `json:"description"`
+	InputSchema json.RawMessage `json:"input_schema"`
+}
+
+type ReqMsgList struct{}
+
+// ResMsgList is carried JSON encoded in the response Msg, it lists the tools
+// deployed in the zone under the app secret.
+type ResMsgList struct {
+	Tools []ListedTool `json:"tools"`
+}
+
+// ListedTool is a deployed tool, Version is the version of its artifact.
+type ListedTool struct {
+	Name       string    `json:"name"`
+	Status     string    `json:"status"`
+	Version    string    `json:"version"`
+	DeployedAt time.Time `json:"deployed_at"`
+}
+
+type ReqMsgMesh struct{}
+
+// ResMsgMesh is carried JSON encoded in the response Msg, it lists the zones
+// currently in the mesh.
+type ResMsgMesh struct {
+	Zones []MeshZone `json:"zones"`
+}
+
+// MeshZone is a zone of the mesh. Health is one of ZoneHealthy, ZoneDegraded
+// or ZoneDown, zones down don't answer requests.
+type MeshZone struct {
+	Name   string `json:"name"`
+	Region string `json:"region"`
+	Health string `json:"health"`
+}
+
+const (
+	ZoneHealthy  = "healthy"
+	ZoneDegraded = "degraded"
+	ZoneDown     = "down"
+)
+
+// ReqMsgMetrics asks for the metrics of the tool between Since and Until,
+// with a series of Points buckets for the charts.
+type ReqMsgMetrics struct {
+	Since  time.Time `json:"since"`
+	Until  time.Time `json:"until"`
+	Points int       `json:"points"`
+}
+
+// ResMsgMetrics is carried JSON encoded in the response Msg, the metrics of
+// the tool in the zone over the requested window. Latencies are in
+// milliseconds, Memory is the resident memory in bytes and CPU the usage in
+// percent of a core, both averaged over the window.
+type ResMsgMetrics struct {
+	Invocations uint64          `json:"invocations"`
+	Errors      uint64          `json:"errors"`
+	LatencyP50  float64         `json:"latency_p50_ms"`
+	LatencyP95  float64         `json:"latency_p95_ms"`
+	LatencyP99  float64         `json:"latency_p99_ms"`
+	Memory      uint64          `json:"memory_bytes"`
+	CPU         float64         `json:"cpu_percent"`
+	Series      []MetricsBucket `json:"series"`
+}
+
+// MetricsBucket holds the metrics of the bucket starting at Time.
+type MetricsBucket struct {
+	Time        time.Time `json:"time"`
+	Invocations uint64    `json:"invocations"`
+	Errors      uint64    `json:"errors"`
+	LatencyP95  float64   `json:"latency_p95_ms"`
+	Memory      uint64    `json:"memory_bytes"`
+	CPU         float64   `json:"cpu_percent"`
+}
+
+// ReqMsgTrace asks for the traces of the Last invocations of the tool, or of
+// the invocation RequestID when set.
+type ReqMsgTrace struct {
+	RequestID string `json:"request_id,omitempty"`
+	Last      int    `json:"last"`
+}
+
+// ResMsgTrace is carried JSON encoded in the response Msg, the traces of the
+// invocations handled by the zone.
+type ResMsgTrace struct {
+	Traces []InvocationTrace `json:"traces"`
+}
+
+// InvocationTrace is the trace of an invocation, TraceID being hex encoded.
+type InvocationTrace struct {
+	RequestID string      `json:"request_id"`
+	TraceID   string      `json:"trace_id"`
+	Spans     []TraceSpan `json:"spans"`
+}
+
+// TraceSpan is a span of an invocation. Service is where the time was spent,
+// such as the zipper or the tool, and the IDs are hex encoded.
+type TraceSpan struct {
+	SpanID       string            `json:"span_id"`
+	ParentSpanID string            `json:"parent_span_id,omitempty"`
+	Name         string            `json:"name"`
+	Service      string            `json:"service"`
+	Start        time.Time         `json:"start"`
+	End          time.Time         `json:"end"`
+	Error        string            `json:"error,omitempty"`
+	Attributes   map[string]string `json:"attributes,omitempty"`
 }
 
 const (
-	TAG_REQUEST_UPLOAD  uint32 = 0xE201
-	TAG_REQUEST_CREATE  uint32 = 0xE202
-	TAG_REQUEST_REMOVE  uint32 = 0xE205
-	TAG_REQUEST_STATUS  uint32 = 0xE206
-	TAG_REQUEST_LOGS    uint32 = 0xE207
-	TAG_RESPONSE_UPLOAD uint32 = 0xF201
-	TAG_RESPONSE_CREATE uint32 = 0xF202
-	TAG_RESPONSE_REMOVE uint32 = 0xF205
-	TAG_RESPONSE_STATUS uint32 = 0xF206
-	TAG_RESPONSE_LOGS   uint32 = 0xF207
+	TAG_REQUEST_HELLO     uint32 = 0xE200
+	TAG_REQUEST_UPLOAD    uint32 = 0xE201
+	TAG_REQUEST_CREATE    uint32 = 0xE202
+	TAG_REQUEST_REMOVE    uint32 = 0xE205
+	TAG_REQUEST_STATUS    uint32 = 0xE206
+	TAG_REQUEST_LOGS      uint32 = 0xE207
+	TAG_REQUEST_INVOKE    uint32 = 0xE208
+	TAG_REQUEST_DESCRIBE  uint32 = 0xE209
+	TAG_REQUEST_LIST      uint32 = 0xE20A
+	TAG_REQUEST_MESH      uint32 = 0xE20B
+	TAG_REQUEST_METRICS   uint32 = 0xE20C
+	TAG_REQUEST_TRACE     uint32 = 0xE20D
+	TAG_RESPONSE_HELLO    uint32 = 0xF200
+	TAG_RESPONSE_UPLOAD   uint32 = 0xF201
+	TAG_RESPONSE_CREATE   uint32 = 0xF202
+	TAG_RESPONSE_REMOVE   uint32 = 0xF205
+	TAG_RESPONSE_STATUS   uint32 = 0xF206
+	TAG_RESPONSE_LOGS     uint32 = 0xF207
+	TAG_RESPONSE_INVOKE   uint32 = 0xF208
+	TAG_RESPONSE_DESCRIBE uint32 = 0xF209
+	TAG_RESPONSE_LIST     uint32 = 0xF20A
+	TAG_RESPONSE_MESH     uint32 = 0xF20B
+	TAG_RESPONSE_METRICS  uint32 = 0xF20C
+	TAG_RESPONSE_TRACE    uint32 = 0xF20D
 )
 
 func ResponseTag(tag uint32) uint32 {
@@ -0,0 +1,345 @@
+package pkg
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// devMainFile is the name of the generated main file, overlaid into the tool
+// package at build time so the source tree is left untouched.
+const devMainFile = "yc_dev_main.go"
+
+// devFuncs are the top-level functions of a tool package which the generated
+// main file wires into the stream function.
+type devFuncs struct {
+	Main         bool
+	Handler      bool
+	Description  bool
+	InputSchema  bool
+	DataTags     bool
+	Init         bool
+	WantedTarget bool
+}
+
+var devMainTemplate = template.Must(template.New(devMainFile).Parse(`// Code generated by yc dev. DO NOT EDIT.
+
+package main
+
+import (
+	"log"
+	"os"
+
+	"github.com/yomorun/yomo"
+)
+
+func main() {
+	addr := os.Getenv("YC_DEV_ZIPPER")
+	sfn := yomo.NewStreamFunction(
+		os.Getenv("YC_DEV_NAME"),
+		addr,
+		yomo.WithSfnCredential(os.Getenv("YC_DEV_CREDENTIAL")),
+{{- if .Description}}
+		yomo.WithSfnAIFunctionDefinition(Description(), {{if .InputSchema}}InputSchema(){{else}}nil{{end}}),
+{{- end}}
+	)
+{{- if .Init}}
+	if err := sfn.Init(Init); err != nil {
+		log.Fatalf("[sfn] init error: %v", err)
+	}
+{{- end}}
+{{- if .DataTags}}
+	sfn.SetObserveDataTags(DataTags()...)
+{{- end}}
+{{- if .WantedTarget}}
+	sfn.SetWantedTarget(WantedTarget())
+{{- end}}
+	sfn.SetHandler(Handler)
+	sfn.SetErrorHandler(func(err error) {
+		log.Printf("[sfn][%s] error: %v", addr, err)
+	})
+	if err := sfn.Connect(); err != nil {
+		log.Fatalf("[sfn] connect to zipper[%s]: %v", addr, err)
+	}
+	log.Printf("[sfn] %s connected to zipper[%s]", os.Getenv("YC_DEV_NAME"), addr)
+	defer sfn.Close()
+	sfn.Wait()
+}
+`))
+
+// scanDevFuncs reports which of the known top-level functions are declared by
+// the non-test .go files in dir.
+func scanDevFuncs(dir string) (devFuncs, error) {
+	var funcs devFuncs
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return funcs, err
+	}
+
+	fset := token.NewFileSet()
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || filepath.Ext(name) != ".go" || strings.HasSuffix(name, "_test.go") || name == devMainFile {
+			continue
+		}
+		f, err := parser.ParseFile(fset, filepath.Join(dir, name), nil, parser.SkipObjectResolution)
+		if err != nil {
+			return funcs, err
+		}
+		for _, decl := range f.Decls {
+			fn, ok := decl.(*ast.FuncDecl)
+			if !ok || fn.Recv != nil {
+				continue
+			}
+			switch fn.Name.Name {
+			case "main":
+				funcs.Main = true
+			case "Handler":
+				funcs.Handler = true
+			case "Description":
+				funcs.Description = true
+			case "InputSchema":
+				funcs.InputSchema = true
+			case "DataTags":
+				funcs.DataTags = true
+			case "Init":
+				funcs.Init = true
+			case "WantedTarget":
+				funcs.WantedTarget = true
+			}
+		}
+	}
+	return funcs, nil
+}
+
+// buildDevTool builds the tool in dir into binPath. Unless the package has its
+// own main function, a main file connecting the Handler as a stream function
+// is generated and overlaid into the package.
+func buildDevTool(dir, binPath string) error {
+	funcs, err := scanDevFuncs(dir)
+	if err != nil {
+		return err
+	}
+
+	args := []string{"build", "-o", binPath}
+	if !funcs.Main {
+		if !funcs.Handler {
+			return errors.New("dev: the tool must declare a Handler function")
+		}
+
+		absDir, err := filepath.Abs(dir)
+		if err != nil {
+			return err
+		}
+
+		var src bytes.Buffer
+		if err := devMainTemplate.Execute(&src, funcs); err != nil {
+			return err
+		}
+		mainPath := filepath.Join(filepath.Dir(binPath), devMainFile)
+		if err := os.WriteFile(mainPath, src.Bytes(), 0644); err != nil {
+			return err
+		}
+
+		overlay, err := json.Marshal(map[string]map[string]string{
+			"Replace": {filepath.Join(absDir, devMainFile): mainPath},
+		})
+		if err != nil {
+			return err
+		}
+		overlayPath := filepath.Join(filepath.Dir(binPath), "overlay.json")
+		if err := os.WriteFile(overlayPath, overlay, 0644); err != nil {
+			return err
+		}
+		args = append(args, "-overlay", overlayPath)
+	}
+	args = append(args, ".")
+
+	var stderr bytes.Buffer
+	cmd := exec.Command("go", args...)
+	cmd.Dir = dir
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("dev: build failed: %w\n%s", err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+// treeSnapshot returns the size and modification time of every file in src
+// which would be packaged by ZipWithExclusions.
+func treeSnapshot(src string) (map[string]string, error) {
+	// polling is quiet, the ignored paths are logged by every walk
+	t, err := newTreeWalker(src, newZipOptions([]ZipOption{WithQuiet()}))
+	if err != nil {
+		return nil, err
+	}
+
+	snapshot := make(map[string]string)
+	stamp := func(p, relPath string) error {
+		info, err := os.Stat(p)
+		if err != nil {
+			return err
+		}
+		snapshot[relPath] = fmt.Sprintf("%d:%d", info.Size(), info.ModTime().UnixNano())
+		return nil
+	}
+	t.addFile = stamp
+	t.addSymlink = func(p, _, relPath string) error { return stamp(p, relPath) }
+
+	if err := t.walk(src, ""); err != nil {
+		return nil, err
+	}
+	return snapshot, nil
+}
+
+// sameSnapshot reports whether two tree snapshots are identical.
+func sameSnapshot(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k, v := range a {
+		if b[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+// devSession builds and runs the tool of dir, rebuilding and reconnecting it
+// whenever its files change.
+type devSession struct {
+	dir      string
+	name     string
+	zipper   string
+	secret   string
+	interval time.Duration
+	out      io.Writer
+
+	tmpDir string
+	proc   *exec.Cmd
+	exited chan struct{}
+}
+
+// run blocks until ctx is done.
+func (s *devSession) run(ctx context.Context) error {
+	if r := DetectRuntime(s.dir); r != RuntimeGo {
+		return fmt.Errorf("dev: %s tools are not supported yet, only go", r)
+	}
+
+	funcs, err := scanDevFuncs(s.dir)
+	if err != nil {
+		return err
+	}
+	if funcs.Main {
+		// nothing is generated, the tool picks its own name
+		fmt.Fprintf(s.out, "Warning: %s declares its own main, which must connect as YC_DEV_NAME (%s) with YC_DEV_ZIPPER and YC_DEV_CREDENTIAL, or it takes the traffic of the deployed tool\n", s.dir, s.name)
+	}
+
+	tmpDir, err := os.MkdirTemp("", "yc-dev-*")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpDir)
+	s.tmpDir = tmpDir
+	defer s.stop()
+
+	snapshot, err := treeSnapshot(s.dir)
+	if err != nil {
+		return err
+	}
+	s.reload()
+
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+
+		current, err := treeSnapshot(s.dir)
+		if err != nil {
+			fmt.Fprintln(s.out, "Error:", err)
+			continue
+		}
+		if sameSnapshot(snapshot, current) {
+			continue
+		}
+		snapshot = current
+
+		fmt.Fprintln(s.out, "Change detected, rebuilding...")
+		s.reload()
+	}
+}
+
+// reload builds the tool and, if the build succeeds, replaces the running
+// process with the new binary. A failed build keeps the previous process.
+func (s *devSession) reload() {
+	binPath := filepath.Join(s.tmpDir, fmt.Sprintf("tool-%d", time.Now().UnixNano()))
+	if runtime.GOOS == "windows" {
+		binPath += ".exe"
+	}
+	if err := buildDevTool(s.dir, binPath); err != nil {
+		fmt.Fprintln(s.out, "Error:", err)
+		return
+	}
+
+	s.stop()
+
+	proc := exec.Command(binPath)
+	proc.Dir = s.dir
+	proc.Env = append(os.Environ(),
+		"YC_DEV_ZIPPER="+s.zipper,
+		"YC_DEV_NAME="+s.name,
+		"YC_DEV_CREDENTIAL="+s.secret,
+	)
+	proc.Stdout = s.out
+	proc.Stderr = s.out
+	if err := proc.Start(); err != nil {
+		fmt.Fprintln(s.out, "Error:", err)
+		return
+	}
+
+	exited := make(chan struct{})
+	go func() {
+		proc.Wait()
+		close(exited)
+	}()
+	s.proc, s.exited = proc, exited
+
+	// the tool reports its own connection, see devMainTemplate
+	fmt.Fprintf(s.out, "Tool %s started, connecting to %s\n", s.name, s.zipper)
+}
+
+// stop kills the running tool process, if any.
+func (s *devSession) stop() {
+	if s.proc == nil {
+		return
+	}
+	select {
+	case <-s.exited:
+	default:
+		s.proc.Process.Kill()
+		<-s.exited
+	}
+	if s.proc.ProcessState != nil && !s.proc.ProcessState.Success() && s.proc.ProcessState.ExitCode() != -1 {
+		fmt.Fprintln(s.out, "Tool exited:", s.proc.ProcessState)
+	}
+	os.Remove(s.proc.Path)
+	s.proc, s.exited = nil, nil
+}
@@ -0,0 +1,144 @@
+package pkg
+
+import (
+	"bytes"
+	"context"
+	"go/format"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestScanDevFuncs(t *testing.T) {
+	tempDir := t.TempDir()
+
+	testFiles := map[string]string{
+		filepath.Join(tempDir, "app.go"):      "package main\n\nfunc Handler() {}\n\nfunc Description() string { return \"\" }\n",
+		filepath.Join(tempDir, "schema.go"):   "package main\n\ntype Args struct{}\n\nfunc InputSchema() any { return &Args{} }\n\nfunc (a *Args) Init() {}\n",
+		filepath.Join(tempDir, "app_test.go"): "package main\n\nfunc main() {}\n",
+	}
+	for filePath, content := range testFiles {
+		if err := os.WriteFile(filePath, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to create file %s: %v", filePath, err)
+		}
+	}
+
+	funcs, err := scanDevFuncs(tempDir)
+	if err != nil {
+		t.Fatalf("scanDevFuncs failed: %v", err)
+	}
+	want := devFuncs{Handler: true, Description: true, InputSchema: true}
+	if funcs != want {
+		t.Errorf("scanDevFuncs() = %+v, want %+v", funcs, want)
+	}
+}
+
+func TestDevMainTemplate(t *testing.T) {
+	for _, funcs := range []devFuncs{
+		{Handler: true},
+		{Handler: true, Description: true, InputSchema: true, DataTags: true, Init: true, WantedTarget: true},
+	} {
+		var src bytes.Buffer
+		if err := devMainTemplate.Execute(&src, funcs); err != nil {
+			t.Fatalf("Failed to execute template: %v", err)
+		}
+		if _, err := format.Source(src.Bytes()); err != nil {
+			t.Errorf("Generated main for %+v is not valid Go: %v\n%s", funcs, err, src.String())
+		}
+		if !strings.Contains(src.String(), `"log"`) {
+			t.Errorf("Generated main for %+v uses log without importing it", funcs)
+		}
+		if funcs.Init != strings.Contains(src.String(), "sfn.Init(Init)") {
+			t.Errorf("Generated main for %+v has unexpected Init call", funcs)
+		}
+	}
+}
+
+func TestTreeSnapshot(t *testing.T) {
+	tempDir := t.TempDir()
+
+	if err := os.MkdirAll(filepath.Join(tempDir, "temp"), 0755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	testFiles := map[string]string{
+		filepath.Join(tempDir, ".gitignore"):        "temp/\n",
+		filepath.Join(tempDir, "app.go"):            "package main\n",
+		filepath.Join(tempDir, "temp", "cache.txt"): "cache",
+	}
+	for filePath, content := range testFiles {
+		if err := os.WriteFile(filePath, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to create file %s: %v", filePath, err)
+		}
+	}
+
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+
+	before, err := treeSnapshot(tempDir)
+	if err != nil {
+		t.Fatalf("treeSnapshot failed: %v", err)
+	}
+	if _, ok := before["temp/cache.txt"]; ok {
+		t.Error("Ignored file should not be part of the snapshot")
+	}
+	if logs.Len() > 0 {
+		t.Errorf("Expected the snapshot to be quiet, got %q", logs.String())
+	}
+
+	// changes to ignored files are not detected
+	if err := os.WriteFile(filepath.Join(tempDir, "temp", "cache.txt"), []byte("new cache"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	after, err := treeSnapshot(tempDir)
+	if err != nil {
+		t.Fatalf("treeSnapshot failed: %v", err)
+	}
+	if !sameSnapshot(before, after) {
+		t.Error("Change to an ignored file should not be detected")
+	}
+
+	if err := os.WriteFile(filepath.Join(tempDir, "util.go"), []byte("package main\n"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	after, err = treeSnapshot(tempDir)
+	if err != nil {
+		t.Fatalf("treeSnapshot failed: %v", err)
+	}
+	if sameSnapshot(before, after) {
+		t.Error("New file should be detected")
+	}
+}
+
+func TestDevSessionWarnsAboutOwnMain(t *testing.T) {
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go toolchain not available")
+	}
+
+	tempDir := t.TempDir()
+	testFiles := map[string]string{
+		filepath.Join(tempDir, "go.mod"):  "module tool\n\ngo 1.21\n",
+		filepath.Join(tempDir, "main.go"): "package main\n\nfunc main() {}\n",
+	}
+	for filePath, content := range testFiles {
+		if err := os.WriteFile(filePath, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to create file %s: %v", filePath, err)
+		}
+	}
+
+	// the session builds and starts the tool once, then stops
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	var out bytes.Buffer
+	s := &devSession{dir: tempDir, name: "tool_dev", interval: time.Second, out: &out}
+	if err := s.run(ctx); err != nil {
+		t.Fatalf("run failed: %v", err)
+	}
+	if !strings.Contains(out.String(), "Warning: "+tempDir+" declares its own main, which must connect as YC_DEV_NAME (tool_dev)") {
+		t.Errorf("Expected a warning about the own main, got %q", out.String())
+	}
+}
@@ -0,0 +1,335 @@
+package pkg
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/quic-go/quic-go"
+	"github.com/yomorun/yomo"
+	ytls "github.com/yomorun/yomo/pkg/tls"
+)
+
+// maxClockSkew is the clock difference with the server reported as a problem.
+const maxClockSkew = 30 * time.Second
+
+type checkStatus int
+
+const (
+	checkOK checkStatus = iota
+	checkWarn
+	checkFail
+	checkSkip
+)
+
+func (s checkStatus) String() string {
+	switch s {
+	case checkOK:
+		return " OK "
+	case checkWarn:
+		return "WARN"
+	case checkFail:
+		return "FAIL"
+	default:
+		return "SKIP"
+	}
+}
+
+// checkResult is the outcome of a single diagnostic step, with a hint on how
+// to fix it when it didn't pass.
+type checkResult struct {
+	name   string
+	status checkStatus
+	detail string
+	hint   string
+}
+
+// doctor diagnoses the connection to the zipper step by step, each step
+// being skipped once a step it depends on failed.
+type doctor struct {
+	c       *command
+	timeout time.Duration
+
+	host    string
+	port    string
+	results []checkResult
+}
+
+// run runs every check and returns their results.
+func (d *doctor) run(ctx context.Context) []checkResult {
+	steps := []struct {
+		name  string
+		check func(ctx context.Context) []checkResult
+	}{
+		{"zipper address", d.checkAddress},
+		{"dns", d.checkDNS},
+		{"udp reachability", d.checkUDP},
+		{"quic/tls handshake", d.checkHandshake},
+		{"credential", d.checkCredential},
+		{"server handshake", d.checkHello},
+	}
+
+	failed := false
+	for _, step := range steps {
+		if failed {
+			d.results = append(d.results, checkResult{name: step.name, status: checkSkip, detail: "skipped after a failed step"})
+			continue
+		}
+		ctx, cancel := context.WithTimeout(ctx, d.timeout)
+		results := step.check(ctx)
+		cancel()
+		for _, r := range results {
+			failed = failed || r.status == checkFail
+		}
+		d.results = append(d.results, results...)
+	}
+	return d.results
+}
+
+func (d *doctor) checkAddress(context.Context) []checkResult {
+	host, port, err := net.SplitHostPort(d.c.zipperAddr)
+	if err == nil {
+		if n, perr := strconv.Atoi(port); perr != nil || n <= 0 || n > 65535 {
+			err = fmt.Errorf("invalid port %q", port)
+		}
+	}
+	if err != nil {
+		return []checkResult{{
+			name:   "zipper address",
+			status: checkFail,
+			detail: err.Error(),
+			hint:   "set --zipper or zipper in yc.yml to host or host:port, e.g. zipper.vivgrid.com:9000",
+		}}
+	}
+	d.host, d.port = host, port
+	return []checkResult{{name: "zipper address", status: checkOK, detail: d.c.zipperAddr}}
+}
+
+func (d *doctor) checkDNS(ctx context.Context) []checkResult {
+	if ip := net.ParseIP(d.host); ip != nil {
+		return []checkResult{{name: "dns", status: checkOK, detail: "not needed for an IP address"}}
+	}
+	addrs, err := net.DefaultResolver.LookupHost(ctx, d.host)
+	if err != nil {
+		return []checkResult{{
+			name:   "dns",
+			status: checkFail,
+			detail: err.Error(),
+			hint:   "check the zipper host name and your network or DNS settings",
+		}}
+	}
+	return []checkResult{{name: "dns", status: checkOK, detail: fmt.Sprintf("%s resolves to %v", d.host, addrs)}}
+}
+
+// quicProbeSize is the size of the probe of checkUDP, QUIC servers ignore
+// the client packets smaller than 1200 bytes.
+const quicProbeSize = 1200
+
+// quicProbeVersion is a reserved QUIC version, which no server speaks.
+const quicProbeVersion = 0x1a2a3a4a
+
+// checkUDP sends a QUIC packet of an unknown version to the zipper, which
+// must answer with a version negotiation packet. This tells a blocked UDP
+// port apart from a failing QUIC or TLS handshake.
+func (d *doctor) checkUDP(ctx context.Context) []checkResult {
+	fail := func(detail string) []checkResult {
+		return []checkResult{{
+			name:   "udp reachability",
+			status: checkFail,
+			detail: detail,
+			hint:   fmt.Sprintf("make sure outgoing UDP traffic to port %s is allowed by your firewall or proxy, QUIC doesn't work over TCP", d.port),
+		}}
+	}
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "udp", d.c.zipperAddr)
+	if err != nil {
+		return fail(err.Error())
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	// a long header Initial packet with 8 byte connection IDs, padded
+	probe := make([]byte, quicProbeSize)
+	probe[0] = 0xc0
+	binary.BigEndian.PutUint32(probe[1:5], quicProbeVersion)
+	probe[5] = 8
+	rand.Read(probe[6:14])
+	probe[14] = 8
+	rand.Read(probe[15:23])
+
+	start := time.Now()
+	if _, err := conn.Write(probe); err != nil {
+		return fail(err.Error())
+	}
+	buf := make([]byte, 1500)
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			if errors.Is(err, os.ErrDeadlineExceeded) {
+				return fail("no answer from " + d.c.zipperAddr)
+			}
+			return fail(err.Error())
+		}
+		// a long header packet of version 0 is a version negotiation
+		if n >= 5 && buf[0]&0x80 != 0 && binary.BigEndian.Uint32(buf[1:5]) == 0 {
+			rtt := time.Since(start).Round(time.Millisecond)
+			return []checkResult{{name: "udp reachability", status: checkOK, detail: fmt.Sprintf("QUIC server answering in %s", rtt)}}
+		}
+	}
+}
+
+// checkHandshake dials the zipper over QUIC the way yomo does, which proves
+// the QUIC and TLS handshakes succeed. The certificate is verified
+// separately, yomo only enforces it with YOMO_TLS_VERIFY_PEER.
+func (d *doctor) checkHandshake(ctx context.Context) []checkResult {
+	tlsConfig, err := ytls.CreateClientTLSConfig()
+	if err != nil {
+		return []checkResult{{
+			name:   "quic/tls handshake",
+			status: checkFail,
+			detail: err.Error(),
+			hint:   "check the YOMO_TLS_* environment variables",
+		}}
+	}
+
+	conn, err := quic.DialAddr(ctx, d.c.zipperAddr, tlsConfig, &quic.Config{HandshakeIdleTimeout: d.timeout})
+	if err != nil {
+		return []checkResult{{
+			name:   "quic/tls handshake",
+			status: checkFail,
+			detail: err.Error(),
+			hint:   "the zipper answers over UDP, check the YOMO_TLS_* environment variables and that the address is a yomo zipper",
+		}}
+	}
+	state := conn.ConnectionState().TLS
+	conn.CloseWithError(0, "")
+
+	results := []checkResult{{
+		name:   "quic/tls handshake",
+		status: checkOK,
+		detail: fmt.Sprintf("%s, alpn %q", tls.VersionName(state.Version), state.NegotiatedProtocol),
+	}}
+
+	certificate := checkResult{name: "tls certificate", status: checkOK, detail: "valid for " + d.host}
+	if err := verifyCertificates(state.PeerCertificates, d.host); err != nil {
+		certificate.status = checkWarn
+		certificate.detail = err.Error()
+		certificate.hint = "the connection still works as yomo doesn't verify the certificate unless YOMO_TLS_VERIFY_PEER=true, set YOMO_TLS_CACERT_FILE for a private CA"
+	}
+	return append(results, certificate)
+}
+
+// verifyCertificates verifies the peer chain against the system roots.
+func verifyCertificates(certs []*x509.Certificate, host string) error {
+	if len(certs) == 0 {
+		return fmt.Errorf("no certificate presented")
+	}
+	intermediates := x509.NewCertPool()
+	for _, cert := range certs[1:] {
+		intermediates.AddCert(cert)
+	}
+	_, err := certs[0].Verify(x509.VerifyOptions{DNSName: host, Intermediates: intermediates})
+	return err
+}
+
+func (d *doctor) checkCredential(ctx context.Context) []checkResult {
+	source := yomo.NewSource("doctor:"+d.c.tid, d.c.zipperAddr, yomo.WithCredential(d.c.secret), yomo.WithLogger(d.c.logger))
+	connected := make(chan error, 1)
+	go func() { connected <- source.Connect() }()
+
+	var err error
+	select {
+	case err = <-connected:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	source.Close()
+
+	if err != nil {
+		return []checkResult{{
+			name:   "credential",
+			status: checkFail,
+			detail: err.Error(),
+			hint:   "check --secret or secret in yc.yml, it is the app secret shown in the vivgrid console",
+		}}
+	}
+	if d.c.secret == "" {
+		return []checkResult{{name: "credential", status: checkWarn, detail: "accepted without secret", hint: "set --secret or secret in yc.yml"}}
+	}
+	return []checkResult{{name: "credential", status: checkOK, detail: "accepted by the zipper"}}
+}
+
+// checkHello runs the hello handshake, checking that the server answers, the
+// spec versions are compatible and the clocks agree.
+func (d *doctor) checkHello(ctx context.Context) []checkResult {
+	deadline, _ := ctx.Deadline()
+	start := time.Now()
+	res, err := query(d.c, TAG_REQUEST_HELLO, newHello(), time.Until(deadline))
+	rtt := time.Since(start)
+	if err != nil {
+		return []checkResult{{
+			name:   "server handshake",
+			status: checkWarn,
+			detail: err.Error(),
+			hint:   "the server predates the hello handshake or the deployer is down, commands still assume spec version " + strconv.Itoa(int(SpecVersion)),
+		}}
+	}
+
+	hello, err := parseHello(res)
+	if err != nil {
+		return []checkResult{{name: "server handshake", status: checkFail, detail: err.Error(), hint: "report this to the server operator"}}
+	}
+	// the commands reuse this fresh handshake
+	storeHello(d.c.zipperAddr, cachedHello{Hello: hello, At: time.Now()}, d.c.logger)
+
+	results := []checkResult{{
+		name:   "server handshake",
+		status: checkOK,
+		detail: fmt.Sprintf("server %s in %s, %s", hello.ServerVersion, res.MeshZone, rtt.Round(time.Millisecond)),
+	}}
+
+	spec := checkResult{name: "spec version", status: checkOK}
+	if version, err := negotiateSpec(hello); err != nil {
+		spec.status, spec.detail, spec.hint = checkFail, err.Error(), "run `yc self-update` or ask the server operator to upgrade"
+	} else {
+		spec.detail = fmt.Sprintf("using %d, yc speaks %v, server speaks %v", version, supportedSpecVersions(), hello.SpecVersions)
+	}
+	results = append(results, spec)
+
+	clock := checkResult{name: "clock skew", status: checkSkip, detail: "the server doesn't report its time"}
+	if !hello.ServerTime.IsZero() {
+		skew := hello.ServerTime.Sub(start.Add(rtt / 2)).Round(time.Millisecond)
+		clock.status, clock.detail = checkOK, fmt.Sprintf("%s from the server", skew)
+		if skew > maxClockSkew || skew < -maxClockSkew {
+			clock.status, clock.hint = checkWarn, "synchronize your system clock with NTP, log timestamps and credentials may be off"
+		}
+	}
+	return append(results, clock)
+}
+
+// printCheckResults prints the checklist and returns the number of failures.
+func printCheckResults(w io.Writer, results []checkResult) int {
+	failures := 0
+	for _, r := range results {
+		fmt.Fprintf(w, "[%s] %-20s %s\n", r.status, r.name, r.detail)
+		if r.hint != "" {
+			fmt.Fprintf(w, "       %-20s hint: %s\n", "", r.hint)
+		}
+		if r.status == checkFail {
+			failures++
+		}
+	}
+	return failures
+}
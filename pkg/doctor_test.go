@@ -0,0 +1,48 @@
+package pkg
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDoctorFailures(t *testing.T) {
+	// a local UDP port which never answers, like one dropped by a firewall
+	silent, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer silent.Close()
+	_, silentPort, _ := net.SplitHostPort(silent.LocalAddr().String())
+
+	tests := []struct {
+		addr     string
+		failed   string
+		expected string
+	}{
+		{"localhost", "zipper address", "missing port"},
+		{"localhost:99999", "zipper address", "invalid port"},
+		{silent.LocalAddr().String(), "udp reachability", "UDP traffic to port " + silentPort},
+	}
+
+	for _, tt := range tests {
+		d := &doctor{c: &command{zipperAddr: tt.addr, tid: "doctor", logger: slog.New(slog.NewTextHandler(io.Discard, nil))}, timeout: 500 * time.Millisecond}
+		results := d.run(context.Background())
+
+		var out bytes.Buffer
+		if failures := printCheckResults(&out, results); failures != 1 {
+			t.Errorf("%s: expected 1 failure, got %d\n%s", tt.addr, failures, out.String())
+		}
+		if !strings.Contains(out.String(), "[FAIL] "+tt.failed) || !strings.Contains(out.String(), tt.expected) {
+			t.Errorf("%s: expected %s to fail with %q\n%s", tt.addr, tt.failed, tt.expected, out.String())
+		}
+		if last := results[len(results)-1]; last.status != checkSkip {
+			t.Errorf("%s: expected the steps after the failure to be skipped\n%s", tt.addr, out.String())
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package fake
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// NewServerCmd returns the `server` command, which runs a fake zipper until
+// it is interrupted.
+func NewServerCmd() *cobra.Command {
+	var (
+		addr     string
+		zones    []string
+		failures []string
+		logsDone bool
+	)
+	cmd := &cobra.Command{
+		Use:   "server",
+		Short: "Run a local zipper emulator answering yc requests",
+		Args:  cobra.ExactArgs(0),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg := Config{Addr: addr, LogsDone: logsDone}
+
+			for _, z := range zones {
+				zone, err := parseZone(z)
+				if err != nil {
+					return err
+				}
+				cfg.Zones = append(cfg.Zones, zone)
+			}
+			if len(cfg.Zones) == 0 {
+				cfg.Zones = append(cfg.Zones, DefaultZones...)
+			}
+
+			for _, f := range failures {
+				name, msg, ok := strings.Cut(f, "=")
+				if !ok {
+					return fmt.Errorf("invalid --fail %q, must be zone=message", f)
+				}
+				found := false
+				for i := range cfg.Zones {
+					if cfg.Zones[i].Name == name {
+						cfg.Zones[i].Failures = failAll(msg)
+						found = true
+					}
+				}
+				if !found {
+					return fmt.Errorf("invalid --fail %q, unknown zone %s", f, name)
+				}
+			}
+
+			s, err := Start(cfg)
+			if err != nil {
+				return err
+			}
+			defer s.Close()
+
+			names := make([]string, len(cfg.Zones))
+			for i, zone := range cfg.Zones {
+				names[i] = zone.Name
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "Fake zipper listening on %s with %d zones: %s\n", s.Addr(), len(names), strings.Join(names, ", "))
+			fmt.Fprintf(cmd.OutOrStdout(), "Use it with: yc --zipper %s --secret any <command>\n", s.Addr())
+
+			return s.Wait()
+		},
+	}
+	cmd.Flags().StringVar(&addr, "addr", "localhost:9000", "UDP address to listen on")
+	cmd.Flags().StringArrayVar(&zones, "zone", nil, "Mesh zone as name or name=latency, e.g. us-east=50ms (default zone-a, zone-b and zone-c)")
+	cmd.Flags().StringArrayVar(&failures, "fail", nil, "Make a zone fail every request, as zone=message")
+	cmd.Flags().BoolVar(&logsDone, "logs-done", false, "End the log stream once the tail is sent")
+	return cmd
+}
+
+// parseZone parses a zone given as name or name=latency.
+func parseZone(s string) (Zone, error) {
+	name, latency, ok := strings.Cut(s, "=")
+	zone := Zone{Name: name}
+	if name == "" {
+		return zone, fmt.Errorf("invalid --zone %q, missing name", s)
+	}
+	if ok {
+		d, err := time.ParseDuration(latency)
+		if err != nil {
+			return zone, fmt.Errorf("invalid --zone %q: %w", s, err)
+		}
+		zone.Latency = d
+	}
+	return zone, nil
+}
+
+// failAll returns failures making every request tag fail with msg.
+func failAll(msg string) map[uint32]string {
+	failures := make(map[uint32]string, len(requestTags))
+	for _, tag := range requestTags {
+		failures[tag] = msg
+	}
+	return failures
+}
@@ -0,0 +1,36 @@
+package fake
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseZone(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Zone
+		wantErr bool
+	}{
+		{in: "us-east", want: Zone{Name: "us-east"}},
+		{in: "eu-west=50ms", want: Zone{Name: "eu-west", Latency: 50 * time.Millisecond}},
+		{in: "=50ms", wantErr: true},
+		{in: "ap-east=soon", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := parseZone(tt.in)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("parseZone(%q) should fail", tt.in)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseZone(%q) failed: %v", tt.in, err)
+			continue
+		}
+		if got.Name != tt.want.Name || got.Latency != tt.want.Latency {
+			t.Errorf("parseZone(%q) = %+v, want %+v", tt.in, got, tt.want)
+		}
+	}
+}
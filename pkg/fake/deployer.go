@@ -0,0 +1,352 @@
+package fake
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/vivgrid/yc/pkg"
+	"github.com/yomorun/yomo/serverless"
+)
+
+// requestTags are the request tags answered by the deployer.
+var requestTags = []uint32{
+	pkg.TAG_REQUEST_HELLO,
+	pkg.TAG_REQUEST_UPLOAD,
+	pkg.TAG_REQUEST_CREATE,
+	pkg.TAG_REQUEST_REMOVE,
+	pkg.TAG_REQUEST_STATUS,
+	pkg.TAG_REQUEST_LOGS,
+	pkg.TAG_REQUEST_INVOKE,
+	pkg.TAG_REQUEST_DESCRIBE,
+	pkg.TAG_REQUEST_LIST,
+	pkg.TAG_REQUEST_MESH,
+	pkg.TAG_REQUEST_METRICS,
+	pkg.TAG_REQUEST_TRACE,
+}
+
+// ServerVersion is the server version announced by the fake.
+const ServerVersion = "fake"
+
+// capabilities are the requests announced in the hello response.
+var capabilities = []string{"upload", "create", "remove", "status", "logs", "logs-range", "invoke", "describe", "list", "zones", "mesh", "metrics", "trace"}
+
+// logTail is the number of log lines sent by each instance of a zone.
+const logTail = 3
+
+func (s *Server) handler(yctx serverless.Context) {
+	data, err := pkg.DecodePayload(yctx.Data())
+	if err != nil {
+		return
+	}
+	header, body, framed := pkg.SplitFrame(data)
+	if !framed {
+		header = data
+	}
+	var req pkg.Request[json.RawMessage]
+	if err := json.Unmarshal(header, &req); err != nil {
+		return
+	}
+
+	r := Request{
+		Tag:        yctx.Tag(),
+		Version:    req.Version,
+		Target:     req.Target,
+		SfnName:    req.SfnName,
+		Zones:      req.Zones,
+		Body:       body,
+		Compressed: len(data) != len(yctx.Data()),
+	}
+	if req.Msg != nil {
+		r.Msg = *req.Msg
+	}
+
+	s.mu.Lock()
+	s.requests = append(s.requests, r)
+	switch r.Tag {
+	case pkg.TAG_REQUEST_UPLOAD:
+		s.uploads[r.SfnName]++
+	case pkg.TAG_REQUEST_CREATE:
+		s.deployments[r.SfnName] = pkg.ListedTool{
+			Name:       r.SfnName,
+			Status:     "running",
+			Version:    fmt.Sprintf("v%d", s.uploads[r.SfnName]),
+			DeployedAt: time.Now(),
+		}
+	case pkg.TAG_REQUEST_REMOVE:
+		delete(s.deployments, r.SfnName)
+	}
+	if r.Tag == pkg.TAG_REQUEST_HELLO {
+		var hello pkg.ReqMsgHello
+		json.Unmarshal(r.Msg, &hello)
+		if slices.Contains(hello.Encodings, pkg.EncodingGzip) {
+			s.encodings[r.Target] = pkg.EncodingGzip
+		}
+	}
+	s.mu.Unlock()
+
+	if r.Tag == pkg.TAG_REQUEST_HELLO && s.noHello {
+		return
+	}
+	for _, zone := range s.zones {
+		if zone.Down || len(req.Zones) > 0 && !slices.Contains(req.Zones, zone.Name) {
+			continue
+		}
+		go s.respond(zone, r)
+	}
+}
+
+// respond sends the answer of zone to r, after the zone latency.
+func (s *Server) respond(zone Zone, r Request) {
+	time.Sleep(zone.Latency)
+
+	if errMsg, ok := zone.Failures[r.Tag]; ok {
+		s.write(r, pkg.Response{MeshZone: zone.Name, Done: true, Error: errMsg})
+		return
+	}
+
+	if r.Tag == pkg.TAG_REQUEST_LOGS {
+		var req pkg.ReqMsgLogs
+		json.Unmarshal(r.Msg, &req)
+		// the i-th line of an instance has Seq i, each instance resumes
+		// after its cursor
+		now := time.Now()
+		for n := 1; n <= max(zone.Instances, 1); n++ {
+			instance := fmt.Sprintf("%s-%d", zone.Name, n)
+			for i := int(req.Cursors[zone.Name][instance]) + 1; i <= logTail; i++ {
+				at := logTime(now, i)
+				if at.Before(req.Since) || (!req.Until.IsZero() && at.After(req.Until)) {
+					continue
+				}
+				line := fmt.Sprintf("%s log line %d", r.SfnName, i)
+				if zone.Instances > 1 {
+					line += " of " + instance
+				}
+				if req.Structured {
+					line = structuredLog(instance, line, i, at)
+				}
+				s.write(r, pkg.Response{MeshZone: zone.Name, Msg: line})
+			}
+		}
+		if s.logsDone || req.NoFollow && !s.ignoreNoFollow {
+			s.write(r, pkg.Response{MeshZone: zone.Name, Done: true})
+		}
+		return
+	}
+
+	for _, progress := range zone.Progress[r.Tag] {
+		s.write(r, pkg.Response{MeshZone: zone.Name, Msg: progress})
+	}
+	msg, ok := zone.Responses[r.Tag]
+	if !ok && r.Tag == pkg.TAG_REQUEST_LIST {
+		msg, ok = s.list(), true
+	}
+	if !ok && r.Tag == pkg.TAG_REQUEST_MESH {
+		msg, ok = s.mesh(), true
+	}
+	if !ok && r.Tag == pkg.TAG_REQUEST_METRICS {
+		msg, ok = metrics(r), true
+	}
+	if !ok && r.Tag == pkg.TAG_REQUEST_TRACE {
+		msg, ok = traces(zone, r), true
+	}
+	if !ok {
+		msg = defaultResponse(r)
+	}
+	s.write(r, pkg.Response{MeshZone: zone.Name, Done: true, Msg: msg})
+}
+
+func (s *Server) write(r Request, res pkg.Response) {
+	s.mu.Lock()
+	enc := s.encodings[r.Target]
+	s.mu.Unlock()
+
+	buf, _ := json.Marshal(res)
+	buf, _ = pkg.EncodePayload(buf, enc)
+	s.source.WriteWithTarget(pkg.ResponseTag(r.Tag), buf, r.Target)
+}
+
+// list returns the tools created and not removed since the fake started.
+func (s *Server) list() string {
+	s.mu.Lock()
+	list := pkg.ResMsgList{Tools: []pkg.ListedTool{}}
+	for _, t := range s.deployments {
+		list.Tools = append(list.Tools, t)
+	}
+	s.mu.Unlock()
+
+	slices.SortFunc(list.Tools, func(a, b pkg.ListedTool) int { return strings.Compare(a.Name, b.Name) })
+	buf, _ := json.Marshal(list)
+	return string(buf)
+}
+
+// logLevels are the levels of the log lines of the fake, in turn.
+var logLevels = []string{"info", "warn", "error"}
+
+// logTime returns the time of the i-th log line, the lines of the tail being
+// written a minute apart until now.
+func logTime(now time.Time, i int) time.Time {
+	return now.Add(-time.Duration(logTail-i) * time.Minute)
+}
+
+// structuredLog returns the i-th log line of instance as a ResMsgLogs written
+// at at, errors being written on stderr.
+func structuredLog(instance, line string, i int, at time.Time) string {
+	msg := pkg.ResMsgLogs{
+		Seq:      uint64(i),
+		Log:      line,
+		Time:     at,
+		Instance: instance,
+		Level:    logLevels[(i-1)%len(logLevels)],
+		Stream:   pkg.LogStdout,
+	}
+	if msg.Level == "error" {
+		msg.Stream = pkg.LogStderr
+	}
+	buf, _ := json.Marshal(msg)
+	return string(buf)
+}
+
+// mesh returns the zones of the fake, as discovered by yc.
+func (s *Server) mesh() string {
+	mesh := pkg.ResMsgMesh{}
+	for _, zone := range s.zones {
+		health := pkg.ZoneHealthy
+		if zone.Down {
+			health = pkg.ZoneDown
+		}
+		mesh.Zones = append(mesh.Zones, pkg.MeshZone{Name: zone.Name, Region: zone.Region, Health: health})
+	}
+	buf, _ := json.Marshal(mesh)
+	return string(buf)
+}
+
+// metrics returns the metrics of the window of r, a bucket being invoked
+// once more than the previous one and failing every fifth.
+func metrics(r Request) string {
+	var req pkg.ReqMsgMetrics
+	json.Unmarshal(r.Msg, &req)
+
+	msg := pkg.ResMsgMetrics{
+		LatencyP50: 12,
+		LatencyP95: 48,
+		LatencyP99: 95.5,
+		Memory:     64 << 20,
+		CPU:        12.5,
+	}
+	step := req.Until.Sub(req.Since) / time.Duration(max(req.Points, 1))
+	for i := range req.Points {
+		b := pkg.MetricsBucket{
+			Time:        req.Since.Add(time.Duration(i) * step),
+			Invocations: uint64(i + 1),
+			LatencyP95:  float64(40 + i%10),
+			Memory:      msg.Memory,
+			CPU:         msg.CPU,
+		}
+		if i%5 == 4 {
+			b.Errors = 1
+		}
+		msg.Invocations += b.Invocations
+		msg.Errors += b.Errors
+		msg.Series = append(msg.Series, b)
+	}
+	buf, _ := json.Marshal(msg)
+	return string(buf)
+}
+
+// traces returns the traces of the last invocations of r, a second apart
+// until now, or the trace of its request ID.
+func traces(zone Zone, r Request) string {
+	var req pkg.ReqMsgTrace
+	json.Unmarshal(r.Msg, &req)
+
+	var ids []string
+	if req.RequestID != "" {
+		ids = append(ids, req.RequestID)
+	} else {
+		for i := range req.Last {
+			ids = append(ids, fmt.Sprintf("%s-req-%d", zone.Name, i+1))
+		}
+	}
+
+	var msg pkg.ResMsgTrace
+	now := time.Now()
+	for i, id := range ids {
+		h := fnv.New64a()
+		h.Write([]byte(zone.Name + id))
+		traceID := fmt.Sprintf("%016x%016x", h.Sum64(), i)
+		start := now.Add(-time.Duration(len(ids)-i) * time.Second)
+		span := func(n int, parent int, name, service string, from, to time.Duration) pkg.TraceSpan {
+			s := pkg.TraceSpan{
+				SpanID:  fmt.Sprintf("%s%04x", traceID[:12], n),
+				Name:    name,
+				Service: service,
+				Start:   start.Add(from),
+				End:     start.Add(to),
+			}
+			if parent > 0 {
+				s.ParentSpanID = fmt.Sprintf("%s%04x", traceID[:12], parent)
+			}
+			return s
+		}
+		llm := span(4, 3, "llm call", r.SfnName, 20*time.Millisecond, 100*time.Millisecond)
+		llm.Attributes = map[string]string{"model": "fake"}
+		msg.Traces = append(msg.Traces, pkg.InvocationTrace{
+			RequestID: id,
+			TraceID:   traceID,
+			Spans: []pkg.TraceSpan{
+				span(1, 0, "invoke", "zipper", 0, 120*time.Millisecond),
+				span(2, 1, "route", "zipper", 0, 2*time.Millisecond),
+				span(3, 1, "handler", r.SfnName, 10*time.Millisecond, 110*time.Millisecond),
+				llm,
+			},
+		})
+	}
+	buf, _ := json.Marshal(msg)
+	return string(buf)
+}
+
+// defaultResponse returns the message answered to r when the zone has no
+// configured response.
+func defaultResponse(r Request) string {
+	switch r.Tag {
+	case pkg.TAG_REQUEST_HELLO:
+		buf, _ := json.Marshal(pkg.ResMsgHello{
+			ServerVersion: ServerVersion,
+			SpecVersions:  []uint32{pkg.SpecVersion},
+			Capabilities:  capabilities,
+			Encodings:     []pkg.Encoding{pkg.EncodingGzip},
+			Codecs:        []string{pkg.FramedCodec.Name(), pkg.JSONCodec.Name()},
+			ServerTime:    time.Now(),
+		})
+		return string(buf)
+	case pkg.TAG_REQUEST_UPLOAD:
+		var msg pkg.ReqMsgUpload
+		json.Unmarshal(r.Msg, &msg)
+		if len(r.Body) > 0 {
+			msg.SetBody(r.Body)
+		}
+		return fmt.Sprintf("uploaded %d bytes of %s source", len(msg.ZipData), msg.Runtime)
+	case pkg.TAG_REQUEST_CREATE:
+		return fmt.Sprintf("created %s", r.SfnName)
+	case pkg.TAG_REQUEST_REMOVE:
+		return fmt.Sprintf("removed %s", r.SfnName)
+	case pkg.TAG_REQUEST_STATUS:
+		return fmt.Sprintf("%s is running", r.SfnName)
+	case pkg.TAG_REQUEST_INVOKE:
+		var msg pkg.ReqMsgInvoke
+		json.Unmarshal(r.Msg, &msg)
+		return fmt.Sprintf("%s called with %s", r.SfnName, msg.Args)
+	case pkg.TAG_REQUEST_DESCRIBE:
+		buf, _ := json.Marshal(pkg.ResMsgDescribe{
+			Description: fmt.Sprintf("%s fake tool", r.SfnName),
+			InputSchema: json.RawMessage(`{"type":"object","properties":{}}`),
+		})
+		return string(buf)
+	default:
+		return "ok"
+	}
+}
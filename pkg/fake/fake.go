@@ -0,0 +1,214 @@
+// Package fake provides an in-process stand-in for the vivgrid zipper mesh, so
+// yc commands can be exercised locally and in tests without a real zipper.
+//
+// A Server runs a yomo zipper and a deployer stream function answering the
+// TAG_REQUEST_* requests of yc with configurable per-zone responses,
+// latencies and failures.
+package fake
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/vivgrid/yc/pkg"
+	"github.com/yomorun/yomo"
+)
+
+// Zone configures how a single mesh zone of the fake answers requests.
+type Zone struct {
+	// Name is the mesh zone name reported in responses.
+	Name string
+	// Latency delays every response of this zone.
+	Latency time.Duration
+	// Responses overrides the message returned for a request tag.
+	Responses map[uint32]string
+	// Failures makes the zone answer a request tag with the given error.
+	Failures map[uint32]string
+	// Progress are the messages the zone sends before its response to a
+	// request tag, without Done.
+	Progress map[uint32][]string
+	// Region is the region reported by mesh discovery.
+	Region string
+	// Down makes the zone reported down by mesh discovery, and never answer.
+	Down bool
+	// Instances is the number of tool instances sending log lines, named
+	// after the zone, e.g. zone-a-1. Defaults to 1.
+	Instances int
+}
+
+// Config configures a fake Server.
+type Config struct {
+	// Addr is the UDP address the zipper listens on, use "localhost:0" to
+	// pick a free port. Defaults to "localhost:9000".
+	Addr string
+	// Zones are the mesh zones answering requests. Defaults to DefaultZones.
+	Zones []Zone
+	// LogsDone makes every zone end the log stream once the tail is sent,
+	// so `yc logs` returns instead of following forever.
+	LogsDone bool
+	// NoHello makes the zones ignore the hello handshake, like the servers
+	// predating it.
+	NoHello bool
+	// IgnoreNoFollow makes the zones keep the log stream open even when the
+	// request asks not to follow it.
+	IgnoreNoFollow bool
+	// Logger receives the yomo logs, they are discarded when nil.
+	Logger *slog.Logger
+}
+
+// DefaultZones mirrors the default mesh size of yc.
+var DefaultZones = []Zone{
+	{Name: "zone-a", Region: "us-east"},
+	{Name: "zone-b", Region: "eu-west"},
+	{Name: "zone-c", Region: "ap-southeast"},
+}
+
+// Request is a request received by the fake deployer.
+type Request struct {
+	Tag     uint32
+	Version uint32
+	Target  string
+	SfnName string
+	// Zones are the zones selected by the request, all when empty.
+	Zones []string
+	Msg   []byte
+	// Body is the binary body of requests sent with pkg.FramedCodec.
+	Body []byte
+	// Compressed is set when the request payload was compressed.
+	Compressed bool
+}
+
+// Server is a running fake zipper with its deployer.
+type Server struct {
+	addr           string
+	zones          []Zone
+	logsDone       bool
+	noHello        bool
+	ignoreNoFollow bool
+	cancel         context.CancelFunc
+	zipper         yomo.Zipper
+	sfn            yomo.StreamFunction
+	source         yomo.Source
+
+	mu       sync.Mutex
+	requests []Request
+	// encodings are the response encodings accepted by each target, as
+	// announced in its hello
+	encodings map[string]pkg.Encoding
+	// uploads counts the uploads of each tool, the version of its artifact
+	uploads map[string]int
+	// deployments are the tools created and not removed, by name
+	deployments map[string]pkg.ListedTool
+	served      chan error
+}
+
+// Start starts the zipper and connects the deployer to it.
+func Start(cfg Config) (*Server, error) {
+	if cfg.Addr == "" {
+		cfg.Addr = "localhost:9000"
+	}
+	if len(cfg.Zones) == 0 {
+		cfg.Zones = DefaultZones
+	}
+	logger := cfg.Logger
+	if logger == nil {
+		logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	}
+
+	conn, err := net.ListenPacket("udp", cfg.Addr)
+	if err != nil {
+		return nil, err
+	}
+
+	zipper, err := yomo.NewZipper("fake-zipper", nil, yomo.WithZipperLogger(logger))
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	server, ok := zipper.(interface {
+		Serve(context.Context, net.PacketConn) error
+	})
+	if !ok {
+		conn.Close()
+		return nil, errors.New("fake: zipper can not serve a packet conn")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &Server{
+		addr:           conn.LocalAddr().String(),
+		zones:          cfg.Zones,
+		logsDone:       cfg.LogsDone,
+		noHello:        cfg.NoHello,
+		ignoreNoFollow: cfg.IgnoreNoFollow,
+		cancel:         cancel,
+		zipper:         zipper,
+		encodings:      make(map[string]pkg.Encoding),
+		uploads:        make(map[string]int),
+		deployments:    make(map[string]pkg.ListedTool),
+		served:         make(chan error, 1),
+	}
+	go func() {
+		s.served <- server.Serve(ctx, conn)
+	}()
+
+	s.source = yomo.NewSource("fake-deployer-res", s.addr, yomo.WithLogger(logger), yomo.WithSourceReConnect())
+	if err := s.source.Connect(); err != nil {
+		s.Close()
+		return nil, fmt.Errorf("fake: connect deployer source: %w", err)
+	}
+
+	s.sfn = yomo.NewStreamFunction("fake-deployer", s.addr, yomo.WithSfnLogger(logger), yomo.WithSfnReConnect())
+	s.sfn.SetObserveDataTags(requestTags...)
+	s.sfn.SetHandler(s.handler)
+	if err := s.sfn.Connect(); err != nil {
+		s.Close()
+		return nil, fmt.Errorf("fake: connect deployer: %w", err)
+	}
+
+	return s, nil
+}
+
+// Addr returns the address the zipper listens on.
+func (s *Server) Addr() string {
+	return s.addr
+}
+
+// Zones returns the configured mesh zones.
+func (s *Server) Zones() []Zone {
+	return s.zones
+}
+
+// Requests returns the requests received so far.
+func (s *Server) Requests() []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	requests := make([]Request, len(s.requests))
+	copy(requests, s.requests)
+	return requests
+}
+
+// Wait blocks until the zipper stops serving.
+func (s *Server) Wait() error {
+	err := <-s.served
+	s.served <- err
+	return err
+}
+
+// Close stops the deployer and the zipper.
+func (s *Server) Close() error {
+	if s.sfn != nil {
+		s.sfn.Close()
+	}
+	if s.source != nil {
+		s.source.Close()
+	}
+	s.cancel()
+	return s.zipper.Close()
+}
@@ -0,0 +1,402 @@
+package pkg
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"go/parser"
+	"go/token"
+	"io/fs"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"golang.org/x/mod/modfile"
+)
+
+// ZipGoFiles creates a zip file from one or more .go source files which
+// belong to the same package directory.
+//
+// A single file outside of any Go module is stored as app.go, as before.
+// Otherwise the files keep their base names at the root of the archive, which
+// is the package built remotely, and when the enclosing module root is found,
+// its go.mod and go.sum are added next to them. The packages of the module
+// imported by the files, directly or not, are added at their path relative
+// to the module root, so the imports resolve in the archive. Files matched
+// by //go:embed directives are included relative to their package directory.
+//
+// Local replace directives in go.mod which point to a directory missing from
+// the archive can not be resolved by the remote builder, a warning is logged
+// for each unless WithVendor is given, in which case the dependencies are
+// vendored.
+func ZipGoFiles(files []string, dst string, opts ...ZipOption) error {
+	options := newZipOptions(opts)
+
+	if len(files) == 0 {
+		return errors.New("no .go files specified")
+	}
+
+	pkgDir, err := sourceDir(files, ".go")
+	if err != nil {
+		return err
+	}
+
+	entries := make(map[string]string) // name in archive -> path on disk
+
+	modRoot := findProjectRoot(pkgDir, []string{"go.mod"})
+	if options.vendor && modRoot == "" {
+		return errors.New("vendor: the .go files are not part of a Go module")
+	}
+	if modRoot == "" && len(files) == 1 {
+		entries["app.go"] = files[0]
+	} else {
+		for _, file := range files {
+			entries[filepath.Base(file)] = file
+		}
+	}
+
+	if modRoot != "" {
+		log.Printf("Found go.mod at %s, packaging module files", modRoot)
+		for _, name := range []string{"go.mod", "go.sum"} {
+			p := filepath.Join(modRoot, name)
+			if _, err := os.Stat(p); err == nil {
+				entries[name] = p
+			}
+		}
+	}
+
+	var vendorDir string
+	if options.vendor {
+		vendorDir, err = vendorModule(modRoot)
+		if err != nil {
+			return err
+		}
+		defer os.RemoveAll(filepath.Dir(vendorDir))
+	}
+
+	// the symlinks of the files and embeds must point inside the module
+	links, err := newLinkWalker(cmp.Or(modRoot, pkgDir), options)
+	if err != nil {
+		return err
+	}
+
+	embeds, err := resolveEmbeds(links, pkgDir, files)
+	if err != nil {
+		return err
+	}
+	for name, p := range embeds {
+		if _, ok := entries[name]; !ok {
+			entries[name] = p
+		}
+	}
+
+	if modRoot != "" {
+		if err := addModulePackages(links, modRoot, pkgDir, files, entries); err != nil {
+			return err
+		}
+	}
+
+	if modRoot != "" && !options.vendor {
+		// go.mod is at the archive root, its replace targets resolve from it
+		packaged := func(target string) bool {
+			_, ok := entries[path.Join(target, "go.mod")]
+			return ok
+		}
+		if err := warnLocalReplaces(modRoot, packaged); err != nil {
+			return err
+		}
+	}
+
+	zipFile, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer zipFile.Close()
+
+	archive := newArchiveWriter(zipFile, options)
+	if err := links.addEntries(archive, entries); err != nil {
+		return err
+	}
+
+	if vendorDir != "" {
+		if err := archive.addDir(vendorDir, "vendor"); err != nil {
+			return err
+		}
+	}
+	return archive.Close()
+}
+
+// addModulePackages adds to entries the .go files and embedded files of the
+// packages of the module at modRoot imported by files, directly or not, keyed
+// by their slash-separated path relative to modRoot.
+func addModulePackages(links *treeWalker, modRoot, pkgDir string, files []string, entries map[string]string) error {
+	gomod := filepath.Join(modRoot, "go.mod")
+	data, err := os.ReadFile(gomod)
+	if err != nil {
+		return err
+	}
+	modPath := modfile.ModulePath(data)
+	if modPath == "" {
+		return fmt.Errorf("%s: no module path", gomod)
+	}
+
+	seen := map[string]bool{pkgDir: true}
+	queue := [][]string{files}
+	for len(queue) > 0 {
+		imports, err := parseImports(queue[0])
+		if err != nil {
+			return err
+		}
+		queue = queue[1:]
+
+		for _, imp := range imports {
+			rel, ok := strings.CutPrefix(imp, modPath)
+			if !ok || (rel != "" && rel[0] != '/') {
+				continue
+			}
+			rel = strings.TrimPrefix(rel, "/")
+			dir := filepath.Join(modRoot, filepath.FromSlash(rel))
+			if seen[dir] {
+				continue
+			}
+			seen[dir] = true
+			if rel == "" {
+				// the archive root holds the packaged files instead
+				return fmt.Errorf("the package in %s imports the root package of module %s, which can't be packaged along with it", pkgDir, modPath)
+			}
+
+			pkgFiles, err := goPackageFiles(dir)
+			if err != nil {
+				return fmt.Errorf("package %s: %w", imp, err)
+			}
+			for _, file := range pkgFiles {
+				entries[rel+"/"+filepath.Base(file)] = file
+			}
+			embeds, err := resolveEmbeds(links, dir, pkgFiles)
+			if err != nil {
+				return err
+			}
+			for name, p := range embeds {
+				entries[rel+"/"+name] = p
+			}
+			queue = append(queue, pkgFiles)
+		}
+	}
+	return nil
+}
+
+// parseImports returns the import paths of files.
+func parseImports(files []string) ([]string, error) {
+	var imports []string
+	fset := token.NewFileSet()
+	for _, file := range files {
+		f, err := parser.ParseFile(fset, file, nil, parser.ImportsOnly)
+		if err != nil {
+			return nil, err
+		}
+		for _, spec := range f.Imports {
+			path, err := strconv.Unquote(spec.Path.Value)
+			if err != nil {
+				return nil, fmt.Errorf("%s: invalid import %s", fset.Position(spec.Pos()), spec.Path.Value)
+			}
+			imports = append(imports, path)
+		}
+	}
+	return imports, nil
+}
+
+// goPackageFiles returns the .go files of the package in dir, except the
+// tests and the files ignored by the go tool.
+func goPackageFiles(dir string) ([]string, error) {
+	dirEntries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, e := range dirEntries {
+		name := e.Name()
+		if e.IsDir() || filepath.Ext(name) != ".go" || strings.HasSuffix(name, "_test.go") ||
+			strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_") {
+			continue
+		}
+		files = append(files, filepath.Join(dir, name))
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no .go files in %s", dir)
+	}
+	return files, nil
+}
+
+// warnLocalReplaces logs a warning for every replace directive in the go.mod
+// of modRoot whose target directory is not packaged. packaged reports whether
+// a relative, slash-separated target is in the archive.
+func warnLocalReplaces(modRoot string, packaged func(target string) bool) error {
+	gomod := filepath.Join(modRoot, "go.mod")
+	data, err := os.ReadFile(gomod)
+	if err != nil {
+		return err
+	}
+	f, err := modfile.Parse(gomod, data, nil)
+	if err != nil {
+		return err
+	}
+	for _, r := range f.Replace {
+		if !modfile.IsDirectoryPath(r.New.Path) {
+			continue
+		}
+		target := filepath.Clean(r.New.Path)
+		if filepath.IsAbs(target) || !packaged(filepath.ToSlash(target)) {
+			log.Printf("Warning: replace %s => %s points outside the packaged tree, the remote build may fail", r.Old.Path, r.New.Path)
+		}
+	}
+	return nil
+}
+
+// isWithin reports whether path is root itself or located under root.
+func isWithin(root, path string) bool {
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		return false
+	}
+	return rel == "." || (rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)))
+}
+
+// resolveEmbeds collects the files matched by //go:embed directives in files,
+// keyed by their slash-separated path relative to pkgDir. Symlinks follow the
+// symlink policy of links.
+func resolveEmbeds(links *treeWalker, pkgDir string, files []string) (map[string]string, error) {
+	result := make(map[string]string)
+	fset := token.NewFileSet()
+	for _, file := range files {
+		f, err := parser.ParseFile(fset, file, nil, parser.ParseComments)
+		if err != nil {
+			return nil, err
+		}
+		for _, group := range f.Comments {
+			for _, c := range group.List {
+				patterns, ok, err := parseEmbedDirective(c.Text)
+				if err != nil {
+					return nil, fmt.Errorf("%s: %w", fset.Position(c.Pos()), err)
+				}
+				if !ok {
+					continue
+				}
+				for _, pattern := range patterns {
+					if err := matchEmbedPattern(links, pkgDir, pattern, result); err != nil {
+						return nil, fmt.Errorf("%s: %w", fset.Position(c.Pos()), err)
+					}
+				}
+			}
+		}
+	}
+	return result, nil
+}
+
+// parseEmbedDirective returns the patterns of a //go:embed comment line, ok
+// is false if the comment is not an embed directive.
+func parseEmbedDirective(text string) (patterns []string, ok bool, err error) {
+	rest, found := strings.CutPrefix(text, "//go:embed")
+	if !found || (rest != "" && rest[0] != ' ' && rest[0] != '\t') {
+		return nil, false, nil
+	}
+	rest = strings.TrimSpace(rest)
+	for rest != "" {
+		var pattern string
+		switch rest[0] {
+		case '"', '`':
+			quote := rest[0]
+			end := strings.IndexByte(rest[1:], quote)
+			if end < 0 {
+				return nil, true, fmt.Errorf("invalid quoted string in //go:embed: %s", rest)
+			}
+			pattern, err = strconv.Unquote(rest[:end+2])
+			if err != nil {
+				return nil, true, fmt.Errorf("invalid quoted string in //go:embed: %s", rest)
+			}
+			rest = rest[end+2:]
+		default:
+			end := strings.IndexAny(rest, " \t")
+			if end < 0 {
+				end = len(rest)
+			}
+			pattern, rest = rest[:end], rest[end:]
+		}
+		patterns = append(patterns, pattern)
+		rest = strings.TrimSpace(rest)
+	}
+	if len(patterns) == 0 {
+		return nil, true, errors.New("usage: //go:embed pattern...")
+	}
+	return patterns, true, nil
+}
+
+// matchEmbedPattern resolves a single embed pattern relative to pkgDir and
+// adds the matching files to result. Directories are added recursively,
+// skipping files beginning with '.' or '_' unless the pattern has the all:
+// prefix, the same way the go tool does. Symlinks are resolved by links like
+// in a walked tree, and the other non-regular files are skipped.
+func matchEmbedPattern(links *treeWalker, pkgDir, pattern string, result map[string]string) error {
+	pattern, all := strings.CutPrefix(pattern, "all:")
+	matches, err := filepath.Glob(filepath.Join(pkgDir, filepath.FromSlash(pattern)))
+	if err != nil {
+		return err
+	}
+	if len(matches) == 0 {
+		return fmt.Errorf("pattern %s: no matching files found", pattern)
+	}
+
+	var walk func(root, prefix string) error
+	walk = func(root, prefix string) error {
+		return filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if p != root && !all && (strings.HasPrefix(d.Name(), ".") || strings.HasPrefix(d.Name(), "_")) {
+				if d.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			rel, err := filepath.Rel(root, p)
+			if err != nil {
+				return err
+			}
+			relPath := path.Join(prefix, filepath.ToSlash(rel))
+
+			switch {
+			case d.Type()&os.ModeSymlink != 0:
+				target, isDir, err := links.resolveSymlink(p, relPath)
+				if errors.Is(err, fs.ErrNotExist) {
+					links.options.logf("Skipping broken symlink: %s", relPath)
+					return nil
+				}
+				if err != nil {
+					return err
+				}
+				if isDir && links.options.symlinks == SymlinkFollow {
+					return links.follow(target, relPath, walk)
+				}
+			case d.IsDir():
+				return nil
+			case !d.Type().IsRegular():
+				links.options.logf("Skipping non-regular file: %s", relPath)
+				return nil
+			}
+			result[relPath] = p
+			return nil
+		})
+	}
+	for _, match := range matches {
+		rel, err := filepath.Rel(pkgDir, match)
+		if err != nil {
+			return err
+		}
+		if err := walk(match, filepath.ToSlash(rel)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
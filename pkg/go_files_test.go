@@ -0,0 +1,288 @@
+package pkg
+
+import (
+	"archive/zip"
+	"bytes"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestZipGoFilesModule(t *testing.T) {
+	tempDir := t.TempDir()
+
+	// Create a module with the package in a sub directory
+	testModule := filepath.Join(tempDir, "test_module")
+	pkgDir := filepath.Join(testModule, "tool")
+	for _, dir := range []string{
+		filepath.Join(pkgDir, "assets", "_hidden"),
+		filepath.Join(testModule, "internal", "greet"),
+		filepath.Join(testModule, "internal", "format"),
+		filepath.Join(testModule, "internal", "unused"),
+		filepath.Join(tempDir, "shared"),
+	} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatalf("Failed to create directory %s: %v", dir, err)
+		}
+	}
+
+	testFiles := map[string]string{
+		filepath.Join(testModule, "go.mod"):                             "module test\n\ngo 1.21\n\nreplace example.com/shared => ../shared\n",
+		filepath.Join(testModule, "go.sum"):                             "",
+		filepath.Join(pkgDir, "app.go"):                                 "package main\n\nimport \"embed\"\n\n//go:embed prompt.txt assets\nvar fs embed.FS\n",
+		filepath.Join(pkgDir, "util.go"):                                "package main\n\nimport _ \"test/internal/greet\"\n",
+		filepath.Join(testModule, "internal", "greet", "greet.go"):      "package greet\n\nimport (\n\t_ \"embed\"\n\t_ \"test/internal/format\"\n)\n\n//go:embed hello.txt\nvar hello string\n",
+		filepath.Join(testModule, "internal", "greet", "hello.txt"):     "hello",
+		filepath.Join(testModule, "internal", "greet", "greet_test.go"): "package greet\n",
+		filepath.Join(testModule, "internal", "format", "format.go"):    "package format\n",
+		filepath.Join(testModule, "internal", "unused", "unused.go"):    "package unused\n",
+		filepath.Join(pkgDir, "prompt.txt"):                             "hello",
+		filepath.Join(pkgDir, "assets", "logo.svg"):                     "<svg/>",
+		filepath.Join(pkgDir, "assets", "_hidden", "secret.txt"):        "hidden",
+		filepath.Join(pkgDir, "unused.txt"):                             "unused",
+	}
+	for filePath, content := range testFiles {
+		if err := os.WriteFile(filePath, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to create file %s: %v", filePath, err)
+		}
+	}
+
+	zipPath := filepath.Join(tempDir, "test_output.zip")
+	err := ZipGoFiles([]string{filepath.Join(pkgDir, "app.go"), filepath.Join(pkgDir, "util.go")}, zipPath)
+	if err != nil {
+		t.Fatalf("ZipGoFiles failed: %v", err)
+	}
+
+	zipContents := readZipNames(t, zipPath)
+
+	expectedFiles := []string{"app.go", "util.go", "go.mod", "go.sum", "prompt.txt", "assets/logo.svg",
+		"internal/greet/greet.go", "internal/greet/hello.txt", "internal/format/format.go"}
+	for _, expectedFile := range expectedFiles {
+		if !zipContents[expectedFile] {
+			t.Errorf("Expected file %s is missing from zip", expectedFile)
+		}
+	}
+
+	excludedFiles := []string{"unused.txt", "assets/_hidden/secret.txt", "internal/greet/greet_test.go", "internal/unused/unused.go"}
+	for _, excludedFile := range excludedFiles {
+		if zipContents[excludedFile] {
+			t.Errorf("Excluded file %s should not be in zip", excludedFile)
+		}
+	}
+}
+
+func TestZipGoFilesEmbedSymlinks(t *testing.T) {
+	tempDir := t.TempDir()
+
+	testModule := filepath.Join(tempDir, "test_module")
+	for _, dir := range []string{filepath.Join(testModule, "static"), filepath.Join(testModule, "data")} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatalf("Failed to create directory %s: %v", dir, err)
+		}
+	}
+	testFiles := map[string]string{
+		filepath.Join(testModule, "go.mod"):               "module test\n\ngo 1.21\n",
+		filepath.Join(testModule, "main.go"):              "package main\n\nimport \"embed\"\n\n//go:embed static\nvar fs embed.FS\n",
+		filepath.Join(testModule, "static", "index.html"): "<html/>",
+		filepath.Join(testModule, "data", "dict.txt"):     "words",
+		filepath.Join(tempDir, "outside.txt"):             "secret",
+	}
+	for filePath, content := range testFiles {
+		if err := os.WriteFile(filePath, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to create file %s: %v", filePath, err)
+		}
+	}
+	if err := os.Symlink("../data", filepath.Join(testModule, "static", "data")); err != nil {
+		t.Skipf("Symlinks not supported: %v", err)
+	}
+
+	// A unix socket is not a regular file and must be skipped
+	if l, err := net.Listen("unix", filepath.Join(testModule, "static", "app.sock")); err == nil {
+		defer l.Close()
+	}
+
+	main := filepath.Join(testModule, "main.go")
+	zipPath := filepath.Join(tempDir, "embed.zip")
+	if err := ZipGoFiles([]string{main}, zipPath); err != nil {
+		t.Fatalf("ZipGoFiles failed: %v", err)
+	}
+	zipContents := readZipNames(t, zipPath)
+	for _, expectedFile := range []string{"static/index.html", "static/data/dict.txt"} {
+		if !zipContents[expectedFile] {
+			t.Errorf("Expected file %s is missing from zip", expectedFile)
+		}
+	}
+	if zipContents["static/app.sock"] {
+		t.Error("Non-regular file static/app.sock should not be in zip")
+	}
+
+	if err := ZipGoFiles([]string{main}, zipPath, WithSymlinks(SymlinkReject)); err == nil {
+		t.Error("Expected error when an embedded symlink is rejected")
+	}
+
+	os.Remove(filepath.Join(testModule, "static", "data"))
+	if err := os.Symlink(filepath.Join(tempDir, "outside.txt"), filepath.Join(testModule, "static", "leak.txt")); err != nil {
+		t.Fatalf("Failed to create symlink: %v", err)
+	}
+	if err := ZipGoFiles([]string{main}, zipPath); err == nil || !strings.Contains(err.Error(), "outside the source tree") {
+		t.Errorf("Expected error when an embedded symlink points outside the module, got %v", err)
+	}
+}
+
+func TestZipGoFilesLocalReplaces(t *testing.T) {
+	tempDir := t.TempDir()
+
+	// A nested module replacing a dependency, not packaged with the files
+	testModule := filepath.Join(tempDir, "test_module")
+	if err := os.MkdirAll(filepath.Join(testModule, "lib"), 0755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	testFiles := map[string]string{
+		filepath.Join(testModule, "go.mod"):        "module test\n\ngo 1.21\n\nrequire example.com/lib v0.0.0\n\nreplace example.com/lib => ./lib\n",
+		filepath.Join(testModule, "main.go"):       "package main\n\nimport _ \"example.com/lib\"\n",
+		filepath.Join(testModule, "lib", "go.mod"): "module example.com/lib\n\ngo 1.21\n",
+		filepath.Join(testModule, "lib", "lib.go"): "package lib\n",
+	}
+	for filePath, content := range testFiles {
+		if err := os.WriteFile(filePath, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to create file %s: %v", filePath, err)
+		}
+	}
+
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+
+	zipPath := filepath.Join(tempDir, "replace.zip")
+	if err := ZipGoFiles([]string{filepath.Join(testModule, "main.go")}, zipPath); err != nil {
+		t.Fatalf("ZipGoFiles failed: %v", err)
+	}
+	if zipContents := readZipNames(t, zipPath); zipContents["lib/lib.go"] {
+		t.Errorf("Expected the replaced module not to be packaged, got %v", zipContents)
+	}
+	if !strings.Contains(logs.String(), "replace example.com/lib => ./lib") {
+		t.Errorf("Expected a warning for the replace missing from the archive, got %q", logs.String())
+	}
+}
+
+func TestZipGoFilesSingleFile(t *testing.T) {
+	tempDir := t.TempDir()
+
+	src := filepath.Join(tempDir, "my_tool.go")
+	if err := os.WriteFile(src, []byte("package main\n"), 0644); err != nil {
+		t.Fatalf("Failed to create file %s: %v", src, err)
+	}
+
+	zipPath := filepath.Join(tempDir, "single.zip")
+	if err := ZipGoFiles([]string{src}, zipPath); err != nil {
+		t.Fatalf("ZipGoFiles failed: %v", err)
+	}
+
+	zipContents := readZipNames(t, zipPath)
+	if len(zipContents) != 1 || !zipContents["app.go"] {
+		t.Errorf("Expected only app.go in zip, got %v", zipContents)
+	}
+}
+
+func TestZipGoFilesErrorCases(t *testing.T) {
+	tempDir := t.TempDir()
+
+	for _, dir := range []string{"a", "b"} {
+		if err := os.MkdirAll(filepath.Join(tempDir, dir), 0755); err != nil {
+			t.Fatalf("Failed to create directory %s: %v", dir, err)
+		}
+	}
+	testFiles := map[string]string{
+		filepath.Join(tempDir, "a", "a.go"):     "package main\n",
+		filepath.Join(tempDir, "b", "b.go"):     "package main\n",
+		filepath.Join(tempDir, "a", "embed.go"): "package main\n\n//go:embed missing.txt\nvar s string\n",
+	}
+	for filePath, content := range testFiles {
+		if err := os.WriteFile(filePath, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to create file %s: %v", filePath, err)
+		}
+	}
+
+	zipPath := filepath.Join(tempDir, "error_test.zip")
+
+	err := ZipGoFiles([]string{filepath.Join(tempDir, "a", "a.go"), filepath.Join(tempDir, "b", "b.go")}, zipPath)
+	if err == nil {
+		t.Error("Expected error when files are in different directories")
+	}
+
+	err = ZipGoFiles([]string{filepath.Join(tempDir, "a", "embed.go")}, zipPath)
+	if err == nil {
+		t.Error("Expected error when embed pattern matches no files")
+	}
+
+	// the root package of the module can't sit at the root of the archive
+	module := filepath.Join(tempDir, "module")
+	if err := os.MkdirAll(filepath.Join(module, "tool"), 0755); err != nil {
+		t.Fatalf("Failed to create directory %s: %v", module, err)
+	}
+	for filePath, content := range map[string]string{
+		filepath.Join(module, "go.mod"):          "module example.com/m\n\ngo 1.21\n",
+		filepath.Join(module, "root.go"):         "package m\n",
+		filepath.Join(module, "tool", "main.go"): "package main\n\nimport _ \"example.com/m\"\n",
+	} {
+		if err := os.WriteFile(filePath, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to create file %s: %v", filePath, err)
+		}
+	}
+	err = ZipGoFiles([]string{filepath.Join(module, "tool", "main.go")}, zipPath)
+	if err == nil || !strings.Contains(err.Error(), "imports the root package of module example.com/m") {
+		t.Errorf("Expected error when importing the module root package, got %v", err)
+	}
+}
+
+func TestParseEmbedDirective(t *testing.T) {
+	tests := []struct {
+		text     string
+		patterns []string
+		ok       bool
+	}{
+		{"//go:embed a.txt b/*.json", []string{"a.txt", "b/*.json"}, true},
+		{"//go:embed \"with space.txt\" `raw.txt`", []string{"with space.txt", "raw.txt"}, true},
+		{"//go:embed all:static", []string{"all:static"}, true},
+		{"//go:embedded", nil, false},
+		{"// regular comment", nil, false},
+	}
+
+	for _, tt := range tests {
+		patterns, ok, err := parseEmbedDirective(tt.text)
+		if err != nil {
+			t.Errorf("parseEmbedDirective(%q) failed: %v", tt.text, err)
+			continue
+		}
+		if ok != tt.ok || len(patterns) != len(tt.patterns) {
+			t.Errorf("parseEmbedDirective(%q) = %v, %v; want %v, %v", tt.text, patterns, ok, tt.patterns, tt.ok)
+			continue
+		}
+		for i := range patterns {
+			if patterns[i] != tt.patterns[i] {
+				t.Errorf("parseEmbedDirective(%q) = %v; want %v", tt.text, patterns, tt.patterns)
+				break
+			}
+		}
+	}
+}
+
+// readZipNames returns the set of file names stored in the zip at zipPath.
+func readZipNames(t *testing.T, zipPath string) map[string]bool {
+	t.Helper()
+
+	zipReader, err := zip.OpenReader(zipPath)
+	if err != nil {
+		t.Fatalf("Failed to open zip file: %v", err)
+	}
+	defer zipReader.Close()
+
+	zipContents := make(map[string]bool)
+	for _, file := range zipReader.File {
+		zipContents[file.Name] = true
+	}
+	return zipContents
+}
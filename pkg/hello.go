@@ -0,0 +1,320 @@
+package pkg
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/yomorun/yomo"
+	"github.com/yomorun/yomo/serverless"
+)
+
+const (
+	// helloTimeout bounds the handshake, servers predating it never answer.
+	helloTimeout = 3 * time.Second
+
+	// helloCacheTTL is how long the handshake of a zipper is reused, a
+	// missing answer included, so that only the first command waits for it.
+	helloCacheTTL = time.Hour
+)
+
+// errTimedOut is returned by query when no zone answered in time.
+var errTimedOut = errors.New("timed out")
+
+// capabilities maps the request tags to the capability names announced by
+// the server in its hello response.
+var capabilities = map[uint32]string{
+	TAG_REQUEST_UPLOAD:   "upload",
+	TAG_REQUEST_CREATE:   "create",
+	TAG_REQUEST_REMOVE:   "remove",
+	TAG_REQUEST_STATUS:   "status",
+	TAG_REQUEST_LOGS:     "logs",
+	TAG_REQUEST_INVOKE:   "invoke",
+	TAG_REQUEST_DESCRIBE: "describe",
+	TAG_REQUEST_LIST:     "list",
+	TAG_REQUEST_MESH:     "mesh",
+	TAG_REQUEST_METRICS:  "metrics",
+	TAG_REQUEST_TRACE:    "trace",
+}
+
+// supportedSpecVersions lists the spec versions spoken by this CLI.
+func supportedSpecVersions() []uint32 {
+	versions := make([]uint32, 0, SpecVersion-MinSpecVersion+1)
+	for v := MinSpecVersion; v <= SpecVersion; v++ {
+		versions = append(versions, v)
+	}
+	return versions
+}
+
+// negotiateSpec picks the highest spec version spoken by both the CLI and the
+// server, or explains which side has to be upgraded.
+func negotiateSpec(hello *ResMsgHello) (uint32, error) {
+	if len(hello.SpecVersions) == 0 {
+		return 0, errors.New("the zipper announced no spec version")
+	}
+	for v := SpecVersion; v >= MinSpecVersion; v-- {
+		if slices.Contains(hello.SpecVersions, v) {
+			return v, nil
+		}
+	}
+
+	if slices.Min(hello.SpecVersions) > SpecVersion {
+		minCli := hello.MinCliVersion
+		if minCli == "" {
+			minCli = "a version supporting spec " + fmt.Sprint(slices.Min(hello.SpecVersions))
+		}
+		return 0, fmt.Errorf("the zipper speaks spec versions %v but yc %s speaks %v, please upgrade yc to >= %s",
+			hello.SpecVersions, CliVersion, supportedSpecVersions(), minCli)
+	}
+	return 0, fmt.Errorf("the zipper speaks spec versions %v but yc %s speaks %v, the zipper %s is too old for this yc",
+		hello.SpecVersions, CliVersion, supportedSpecVersions(), hello.ServerVersion)
+}
+
+// negotiate runs the hello handshake once, and sets the spec version, codec
+// and payload encoding of the following requests. Servers which don't answer
+// are assumed to speak SpecVersion with every capability, JSONCodec and no
+// compression, as before the handshake existed. The zones of the mesh are
+// then discovered, unless the mesh size is configured.
+func (c *command) negotiate() error {
+	if c.hello != nil || c.helloErr != nil {
+		return nil
+	}
+
+	msg, err := c.handshake()
+	if err != nil {
+		c.helloErr = err
+		return nil
+	}
+	version, err := negotiateSpec(msg)
+	if err != nil {
+		return err
+	}
+	c.hello, c.specVersion = msg, version
+	c.encoding = pickEncoding(msg.Encodings)
+	c.codec = pickCodec(msg.Codecs)
+
+	if !c.meshSet && slices.Contains(msg.Capabilities, capabilities[TAG_REQUEST_MESH]) {
+		// the mesh size of the configuration is used when discovery fails
+		if c.mesh, err = c.discoverMesh(helloTimeout); err != nil {
+			c.logger.Warn("mesh discovery failed", "error", err)
+		}
+	}
+	return c.checkZones()
+}
+
+// handshake returns the hello response of the zipper, cached per zipper for
+// helloCacheTTL. A cached response the CLI can't speak with is refreshed, the
+// server may have been upgraded since.
+func (c *command) handshake() (*ResMsgHello, error) {
+	if cached, ok := loadHello(c.zipperAddr); ok {
+		if cached.Hello == nil {
+			return nil, errors.New(cached.Error)
+		}
+		if _, err := negotiateSpec(cached.Hello); err == nil {
+			return cached.Hello, nil
+		}
+	}
+
+	res, err := query(c, TAG_REQUEST_HELLO, newHello(), helloTimeout)
+	if errors.Is(err, errTimedOut) {
+		// the server predates the handshake, don't wait for it again
+		storeHello(c.zipperAddr, cachedHello{Error: err.Error(), At: time.Now()}, c.logger)
+	}
+	if err != nil {
+		return nil, err
+	}
+	msg, err := parseHello(res)
+	if err != nil {
+		return nil, err
+	}
+	storeHello(c.zipperAddr, cachedHello{Hello: msg, At: time.Now()}, c.logger)
+	return msg, nil
+}
+
+// newHello returns the hello request of this CLI.
+func newHello() *ReqMsgHello {
+	return &ReqMsgHello{
+		CliVersion:   CliVersion,
+		SpecVersions: supportedSpecVersions(),
+		Encodings:    supportedEncodings,
+		Codecs:       codecNames(supportedCodecs),
+	}
+}
+
+// parseHello returns the hello response carried by res.
+func parseHello(res *Response) (*ResMsgHello, error) {
+	var msg ResMsgHello
+	if err := json.Unmarshal([]byte(res.Msg), &msg); err != nil {
+		return nil, fmt.Errorf("[%s] invalid hello: %w", res.MeshZone, err)
+	}
+	return &msg, nil
+}
+
+// cachedHello is the handshake of a zipper at At, Hello is nil when the
+// zipper didn't answer it.
+type cachedHello struct {
+	Hello *ResMsgHello `json:"hello,omitempty"`
+	Error string       `json:"error,omitempty"`
+	At    time.Time    `json:"at"`
+}
+
+// helloCachePath returns the file caching the handshakes, keyed by zipper
+// address, in YC_CACHE_DIR or else the user cache directory.
+func helloCachePath() (string, error) {
+	if dir := os.Getenv("YC_CACHE_DIR"); dir != "" {
+		return filepath.Join(dir, "hello.json"), nil
+	}
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "yc", "hello.json"), nil
+}
+
+func readHelloCache() map[string]cachedHello {
+	cache := make(map[string]cachedHello)
+	path, err := helloCachePath()
+	if err != nil {
+		return cache
+	}
+	if data, err := os.ReadFile(path); err == nil {
+		json.Unmarshal(data, &cache)
+	}
+	return cache
+}
+
+// loadHello returns the handshake of zipper cached less than helloCacheTTL ago.
+func loadHello(zipper string) (cachedHello, bool) {
+	cached, ok := readHelloCache()[zipper]
+	if !ok || time.Since(cached.At) > helloCacheTTL || cached.At.After(time.Now()) {
+		return cachedHello{}, false
+	}
+	return cached, true
+}
+
+// storeHello caches the handshake of zipper, failures are only logged as the
+// handshake is run again next time.
+func storeHello(zipper string, hello cachedHello, logger *slog.Logger) {
+	path, err := helloCachePath()
+	if err == nil {
+		err = os.MkdirAll(filepath.Dir(path), 0755)
+	}
+	if err != nil {
+		logger.Debug("failed to cache the handshake", "error", err)
+		return
+	}
+
+	cache := readHelloCache()
+	for addr, cached := range cache {
+		if time.Since(cached.At) > helloCacheTTL {
+			delete(cache, addr)
+		}
+	}
+	cache[zipper] = hello
+	data, _ := json.Marshal(cache)
+
+	// renamed into place, commands may run concurrently
+	tmp, err := os.CreateTemp(filepath.Dir(path), "hello-*.json")
+	if err == nil {
+		_, err = tmp.Write(data)
+		if cerr := tmp.Close(); err == nil {
+			err = cerr
+		}
+		if err == nil {
+			err = os.Rename(tmp.Name(), path)
+		}
+		if err != nil {
+			os.Remove(tmp.Name())
+		}
+	}
+	if err != nil {
+		logger.Debug("failed to cache the handshake", "error", err)
+	}
+}
+
+// supports reports whether the server announced the capability of tag. It is
+// assumed when the handshake failed or announced no capabilities.
+func (c *command) supports(tag uint32) bool {
+	if c.hello == nil || len(c.hello.Capabilities) == 0 {
+		return true
+	}
+	return slices.Contains(c.hello.Capabilities, capabilities[tag])
+}
+
+// query sends a single request and returns the first successful response of
+// any zone, or the last error once every zone failed.
+func query[T any](c *command, tag uint32, reqMsg *T, timeout time.Duration) (*Response, error) {
+	responses := make(chan Response, c.expectedResponses())
+
+	sfn := yomo.NewStreamFunction("query-res:"+c.tid, c.zipperAddr, yomo.WithSfnCredential(c.secret), yomo.WithSfnLogger(c.logger))
+	sfn.SetHandler(func(yctx serverless.Context) {
+		data, err := DecodePayload(yctx.Data())
+		if err != nil {
+			return
+		}
+		var res Response
+		if err := json.Unmarshal(data, &res); err != nil {
+			return
+		}
+		c.logResponse(yctx.Tag(), &res, len(yctx.Data()))
+		if !res.Done {
+			return
+		}
+		select {
+		case responses <- res:
+		default:
+		}
+	})
+	sfn.SetObserveDataTags(ResponseTag(tag))
+	sfn.SetWantedTarget(c.tid)
+	if err := sfn.Connect(); err != nil {
+		return nil, err
+	}
+	defer sfn.Close()
+
+	source := yomo.NewSource("query-req:"+c.tid, c.zipperAddr, yomo.WithCredential(c.secret), yomo.WithLogger(c.logger))
+	if err := source.Connect(); err != nil {
+		return nil, err
+	}
+	defer source.Close()
+
+	req := &Request[T]{
+		Version: c.specVersion,
+		Target:  c.tid,
+		SfnName: c.tool,
+		Msg:     reqMsg,
+	}
+	buf, err := c.codec.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	if buf, err = EncodePayload(buf, c.encoding); err != nil {
+		return nil, err
+	}
+	c.logRequest(tag, req, len(buf))
+	source.Write(tag, buf)
+
+	deadline := time.After(timeout)
+	var lastErr error
+	for count := uint32(0); count < c.expectedResponses(); count++ {
+		select {
+		case res := <-responses:
+			if res.Error != "" {
+				lastErr = fmt.Errorf("[%s] %s", res.MeshZone, res.Error)
+				continue
+			}
+			return &res, nil
+		case <-deadline:
+			return nil, fmt.Errorf("%w after %s waiting for the zipper", errTimedOut, timeout)
+		}
+	}
+	if lastErr == nil {
+		lastErr = errors.New("no zone answered")
+	}
+	return nil, lastErr
+}
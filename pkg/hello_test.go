@@ -0,0 +1,60 @@
+package pkg
+
+import (
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNegotiateSpec(t *testing.T) {
+	tests := []struct {
+		hello    ResMsgHello
+		version  uint32
+		expected string
+	}{
+		{ResMsgHello{SpecVersions: []uint32{SpecVersion}}, SpecVersion, ""},
+		{ResMsgHello{SpecVersions: []uint32{1, SpecVersion, SpecVersion + 1}}, SpecVersion, ""},
+		{ResMsgHello{SpecVersions: []uint32{SpecVersion + 1}, MinCliVersion: "v9.0.0"}, 0, "please upgrade yc to >= v9.0.0"},
+		{ResMsgHello{SpecVersions: []uint32{SpecVersion + 1}}, 0, "please upgrade yc to >= a version supporting spec 3"},
+		{ResMsgHello{SpecVersions: []uint32{MinSpecVersion - 1}, ServerVersion: "v0.1.0"}, 0, "the zipper v0.1.0 is too old"},
+		{ResMsgHello{}, 0, "no spec version"},
+	}
+
+	for _, tt := range tests {
+		version, err := negotiateSpec(&tt.hello)
+		if tt.expected == "" {
+			if err != nil || version != tt.version {
+				t.Errorf("negotiateSpec(%+v) = %d, %v, want %d", tt.hello, version, err, tt.version)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.expected) {
+			t.Errorf("negotiateSpec(%+v) = %v, want error containing %q", tt.hello, err, tt.expected)
+		}
+	}
+}
+
+func TestHelloCache(t *testing.T) {
+	t.Setenv("YC_CACHE_DIR", t.TempDir())
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	if _, ok := loadHello("zipper-a:9000"); ok {
+		t.Fatal("Expected an empty cache")
+	}
+
+	storeHello("zipper-a:9000", cachedHello{Hello: &ResMsgHello{ServerVersion: "1.0"}, At: time.Now()}, logger)
+	storeHello("zipper-b:9000", cachedHello{Error: "timed out", At: time.Now()}, logger)
+	storeHello("zipper-c:9000", cachedHello{Error: "timed out", At: time.Now().Add(-2 * helloCacheTTL)}, logger)
+
+	if cached, ok := loadHello("zipper-a:9000"); !ok || cached.Hello == nil || cached.Hello.ServerVersion != "1.0" {
+		t.Errorf("Unexpected cached hello %+v, %v", cached, ok)
+	}
+	if cached, ok := loadHello("zipper-b:9000"); !ok || cached.Hello != nil || cached.Error != "timed out" {
+		t.Errorf("Expected the missing answer to be cached, got %+v, %v", cached, ok)
+	}
+	if _, ok := loadHello("zipper-c:9000"); ok {
+		t.Error("Expected an expired entry not to be used")
+	}
+}
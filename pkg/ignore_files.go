@@ -1,11 +1,14 @@
 package pkg
 
 import (
-	"archive/zip"
+	"errors"
+	"fmt"
 	"io"
-	"log"
+	"io/fs"
 	"os"
+	"path"
 	"path/filepath"
+	"sort"
 	"strings"
 
 	"github.com/codeglyph/go-dotignore"
@@ -19,105 +22,404 @@ import (
 //   - .vscode/  (VS Code settings directory)
 //   - .DS_Store (macOS system file)
 //
+// Runtime-specific ignore patterns, depending on the detected runtime:
+//   - node_modules/ (Node.js)
+//   - __pycache__/, *.pyc, .venv/ (Python)
+//
 // If a .gitignore file exists in the source directory, its patterns will also be applied.
 // The function uses gitignore-style pattern matching for consistent behavior.
-func ZipWithExclusions(src, dst string) error {
+//
+// If src is a Go module root, local replace directives pointing outside of src
+// are reported, or resolved by vendoring the dependencies when WithVendor is
+// given.
+//
+// Symlinks are handled according to WithSymlinks, following them within the
+// source tree by default. Sockets, devices and other non-regular files are
+// skipped.
+func ZipWithExclusions(src, dst string, opts ...ZipOption) error {
+	options := newZipOptions(opts)
+
+	var vendorDir string
+	if _, err := os.Stat(filepath.Join(src, "go.mod")); err == nil {
+		if options.vendor {
+			vendorDir, err = vendorModule(src)
+			if err != nil {
+				return err
+			}
+			defer os.RemoveAll(filepath.Dir(vendorDir))
+		} else {
+			packaged := func(target string) bool { return isWithin(src, filepath.Join(src, target)) }
+			if err := warnLocalReplaces(src, packaged); err != nil {
+				return err
+			}
+		}
+	} else if options.vendor {
+		return fmt.Errorf("vendor: no go.mod found in %s", src)
+	}
+
 	zipFile, err := os.Create(dst)
 	if err != nil {
 		return err
 	}
 	defer zipFile.Close()
 
-	zipWriter := zip.NewWriter(zipFile)
-	defer zipWriter.Close()
+	archive := newArchiveWriter(zipFile, options)
 
-	// Build unified ignore matcher: built-in patterns + optional .gitignore contents.
-	builtinPatterns := []string{
-		".git/",     // Git repository directory
-		".vscode/",  // VS Code settings directory
-		".DS_Store", // macOS system file
-		".env",      // Environment variable file
+	t, err := newTreeWalker(src, options)
+	if err != nil {
+		return err
 	}
-	var builder strings.Builder
-	for _, p := range builtinPatterns {
-		builder.WriteString(p)
-		builder.WriteString("\n")
+	t.vendorDir = vendorDir
+	t.addFile = archive.addFile
+	t.addSymlink = archive.addSymlink
+	if err := t.walk(src, ""); err != nil {
+		return err
 	}
 
-	// Look for .gitignore in the source directory, not current working directory
-	gitignorePath := filepath.Join(src, ".gitignore")
-	if data, err := os.ReadFile(gitignorePath); err == nil {
-		log.Printf("Found .gitignore at %s, applying additional patterns", gitignorePath)
-		builder.Write(data)
-		if !strings.HasSuffix(builder.String(), "\n") {
-			builder.WriteString("\n")
+	if vendorDir != "" {
+		if err := archive.addDir(vendorDir, "vendor"); err != nil {
+			return err
 		}
 	}
-	matcher, err := dotignore.NewPatternMatcherFromReader(strings.NewReader(builder.String()))
+	return archive.Close()
+}
+
+// treeWalker visits the files of a source tree, applying the ignore rules and
+// the symlink policy.
+type treeWalker struct {
+	realSrc   string // src with symlinks resolved
+	vendorDir string
+	matcher   *ignoreMatcher
+	options   *zipOptions
+	// following are the real directories of the symlinks being followed,
+	// a link to one of them creates a cycle
+	following map[string]bool
+
+	// addFile is called for every included file, and for followed symlinks
+	addFile func(p, relPath string) error
+	// addSymlink is called for included symlinks stored as links
+	addSymlink func(p, target, relPath string) error
+}
+
+// newTreeWalker builds the walker of src, with the built-in, runtime and
+// .gitignore ignore rules.
+func newTreeWalker(src string, options *zipOptions) (*treeWalker, error) {
+	// Build unified ignore matcher: built-in patterns + optional .gitignore contents.
+	matcher, err := newIgnoreMatcher(src, DetectRuntime(src), options)
+	if err != nil {
+		return nil, err
+	}
+
+	realSrc, err := filepath.EvalSymlinks(src)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	// traverse the src directory, check each file against the ignore patterns
-	// and add it to the zip file if it doesn't match
-	return filepath.WalkDir(src, func(path string, d os.DirEntry, err error) error {
+	return &treeWalker{
+		realSrc:   realSrc,
+		matcher:   matcher,
+		options:   options,
+		following: make(map[string]bool),
+	}, nil
+}
+
+// walk traverses root, check each file against the ignore patterns and add it
+// to the zip file if it doesn't match. prefix is the relative path of root in
+// the archive, it is empty for the source directory itself and set for
+// followed directory symlinks.
+func (t *treeWalker) walk(root, prefix string) error {
+	explain := t.options.explain
+	return filepath.WalkDir(root, func(p string, d os.DirEntry, err error) error {
 		if err != nil {
-			log.Println("\t --err:", err)
+			t.options.logf("\t --err: %v", err)
 			return err
 		}
+		if p == root {
+			return nil
+		}
 
 		// Relative path (POSIX style) for matching and zip header.
-		relPath, err := filepath.Rel(src, path)
+		relPath, err := filepath.Rel(root, p)
 		if err != nil {
 			return err
 		}
-		relPath = filepath.ToSlash(relPath)
+		relPath = path.Join(prefix, filepath.ToSlash(relPath))
 
-		if d.IsDir() {
-			if ignore, _ := matcher.Matches(relPath + "/"); ignore { // ensure directory semantics
-				log.Printf("Ignoring directory: %s", relPath)
-				return filepath.SkipDir
+		isDir := d.IsDir()
+		var target string
+		if d.Type()&os.ModeSymlink != 0 {
+			target, isDir, err = t.resolveSymlink(p, relPath)
+			if errors.Is(err, fs.ErrNotExist) {
+				explainPath(explain, relPath, true, nil, "broken symlink")
+				t.options.logf("Skipping broken symlink: %s", relPath)
+				return nil
+			}
+			if err != nil {
+				return err
 			}
+		} else if !isDir && !d.Type().IsRegular() {
+			explainPath(explain, relPath, true, nil, "not a regular file")
+			t.options.logf("Skipping non-regular file: %s", relPath)
 			return nil
 		}
 
-		if ignore, _ := matcher.Matches(relPath); ignore {
-			log.Printf("Ignoring file: %s", relPath)
+		if isDir {
+			if t.vendorDir != "" && relPath == "vendor" {
+				// replaced by the freshly generated vendor directory
+				explainPath(explain, relPath+"/", false, nil, "replaced by --vendor")
+				return filepath.SkipDir
+			}
+			ignore, rule := t.matcher.match(relPath + "/") // ensure directory semantics
+			explainPath(explain, relPath+"/", ignore, rule, "")
+			if ignore {
+				t.options.logf("Ignoring directory: %s", relPath)
+				return filepath.SkipDir
+			}
+			if target != "" && t.options.symlinks == SymlinkFollow {
+				return t.follow(target, relPath, t.walk)
+			}
+		} else {
+			ignore, rule := t.matcher.match(relPath)
+			explainPath(explain, relPath, ignore, rule, "")
+			if ignore {
+				t.options.logf("Ignoring file: %s", relPath)
+				return nil
+			}
+		}
+
+		if target != "" && t.options.symlinks == SymlinkStore {
+			return t.addSymlink(p, target, relPath)
+		}
+		if isDir {
 			return nil
 		}
 
-		// add the file to the zip archive
-		// Create zip header using the relative file path.
-		fileInfo, err := d.Info()
+		// add the file to the zip archive, relPath already slash-normalized above.
+		return t.addFile(p, relPath)
+	})
+}
+
+// follow walks the directory target of a followed symlink, failing when
+// the directory is already being followed through another link.
+func (t *treeWalker) follow(target, relPath string, walk func(root, prefix string) error) error {
+	if t.following[target] {
+		return fmt.Errorf("symlink %s creates a cycle", relPath)
+	}
+	t.following[target] = true
+	defer delete(t.following, target)
+	return walk(target, relPath)
+}
+
+// newLinkWalker returns the walker applying the symlink policy to the files
+// under src which are packaged without walking the tree, like the source
+// files given explicitly and the files matched by //go:embed directives.
+func newLinkWalker(src string, options *zipOptions) (*treeWalker, error) {
+	realSrc, err := filepath.EvalSymlinks(src)
+	if err != nil {
+		return nil, err
+	}
+	return &treeWalker{
+		realSrc:   realSrc,
+		options:   options,
+		following: make(map[string]bool),
+	}, nil
+}
+
+// addEntries writes entries, paths on disk keyed by their name in the
+// archive, in name order. As in a walked tree, symlinks follow the symlink
+// policy and the other non-regular files are skipped.
+func (t *treeWalker) addEntries(archive *archiveWriter, entries map[string]string) error {
+	names := make([]string, 0, len(entries))
+	for name := range entries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		p := entries[name]
+		info, err := os.Lstat(p)
 		if err != nil {
 			return err
 		}
-		header, err := zip.FileInfoHeader(fileInfo)
-		if err != nil {
+		if info.Mode()&os.ModeSymlink != 0 {
+			target, isDir, err := t.resolveSymlink(p, name)
+			if errors.Is(err, fs.ErrNotExist) {
+				t.options.logf("Skipping broken symlink: %s", name)
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			if t.options.symlinks == SymlinkStore {
+				err = archive.addSymlink(p, target, name)
+			} else if isDir {
+				err = fmt.Errorf("symlink %s points to a directory", name)
+			} else {
+				err = archive.addFile(target, name)
+			}
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		if !info.Mode().IsRegular() {
+			t.options.logf("Skipping non-regular file: %s", name)
+			continue
+		}
+		if err := archive.addFile(p, name); err != nil {
 			return err
 		}
+	}
+	return nil
+}
 
-		// relPath already slash-normalized above.
-		header.Name = relPath
-		header.Method = zip.Deflate
+// resolveSymlink applies the symlink policy to the link at p. It returns the
+// resolved target and whether it is a directory. Links are rejected by
+// SymlinkReject, and by SymlinkFollow when they point outside the source tree
+// or to one of their own parent directories.
+func (t *treeWalker) resolveSymlink(p, relPath string) (string, bool, error) {
+	if t.options.symlinks == SymlinkReject {
+		return "", false, fmt.Errorf("symlink %s is not allowed", relPath)
+	}
 
-		writer, err := zipWriter.CreateHeader(header)
-		if err != nil {
-			return err
+	target, err := filepath.EvalSymlinks(p)
+	if err != nil {
+		return "", false, fmt.Errorf("symlink %s: %w", relPath, err)
+	}
+	if !isWithin(t.realSrc, target) {
+		return "", false, fmt.Errorf("symlink %s points outside the source tree", relPath)
+	}
+	info, err := os.Stat(target)
+	if err != nil {
+		return "", false, err
+	}
+
+	if t.options.symlinks == SymlinkFollow {
+		if info.IsDir() {
+			realParent, err := filepath.EvalSymlinks(filepath.Dir(p))
+			if err != nil {
+				return "", false, err
+			}
+			if isWithin(target, realParent) {
+				return "", false, fmt.Errorf("symlink %s creates a cycle", relPath)
+			}
+		} else if !info.Mode().IsRegular() {
+			return "", false, fmt.Errorf("symlink %s does not point to a regular file", relPath)
 		}
+	}
+	return target, info.IsDir(), nil
+}
 
-		// Open the source file.
-		f, err := os.Open(path)
-		if err != nil {
-			return err
+// builtinIgnorePatterns are always applied before the .gitignore patterns.
+var builtinIgnorePatterns = []string{
+	".git/",     // Git repository directory
+	".vscode/",  // VS Code settings directory
+	".DS_Store", // macOS system file
+	".env",      // Environment variable file
+}
+
+// ignoreRule is a single ignore pattern together with where it comes from.
+type ignoreRule struct {
+	source  string // "builtin" or the ignore file name
+	line    int    // line number in source, 0 for builtin rules
+	pattern string // the pattern as written, including a leading '!'
+	negate  bool
+	matcher *dotignore.PatternMatcher
+}
+
+func (r *ignoreRule) String() string {
+	if r.line == 0 {
+		return fmt.Sprintf("%s %s", r.source, r.pattern)
+	}
+	return fmt.Sprintf("%s:%d %s", r.source, r.line, r.pattern)
+}
+
+// ignoreMatcher evaluates gitignore-style rules in order, the last matching
+// rule decides whether a path is ignored.
+type ignoreMatcher struct {
+	rules []*ignoreRule
+}
+
+// newIgnoreMatcher builds the matcher from the built-in patterns, the default
+// patterns of runtime and the .gitignore file in src, if any.
+func newIgnoreMatcher(src string, runtime Runtime, options *zipOptions) (*ignoreMatcher, error) {
+	m := &ignoreMatcher{}
+	for _, p := range builtinIgnorePatterns {
+		if err := m.add("builtin", 0, p); err != nil {
+			return nil, err
 		}
-		defer func() {
-			if closeErr := f.Close(); closeErr != nil {
-				log.Printf("Warning: failed to close file %s: %v", path, closeErr)
+	}
+	if spec := specForRuntime(runtime); spec != nil {
+		for _, p := range spec.ignores {
+			if err := m.add("builtin:"+string(runtime), 0, p); err != nil {
+				return nil, err
 			}
-		}()
+		}
+	}
 
-		_, err = io.Copy(writer, f)
-		return err
-	})
+	// Look for .gitignore in the source directory, not current working directory
+	gitignorePath := filepath.Join(src, ".gitignore")
+	if data, err := os.ReadFile(gitignorePath); err == nil {
+		options.logf("Found .gitignore at %s, applying additional patterns", gitignorePath)
+		for i, line := range strings.Split(string(data), "\n") {
+			if err := m.add(".gitignore", i+1, line); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return m, nil
+}
+
+// add appends a rule, empty lines and comments are skipped.
+func (m *ignoreMatcher) add(source string, line int, pattern string) error {
+	pattern = strings.TrimSpace(pattern)
+	if pattern == "" || strings.HasPrefix(pattern, "#") {
+		return nil
+	}
+
+	rule := &ignoreRule{source: source, line: line, pattern: pattern}
+	p := pattern
+	if strings.HasPrefix(p, "!") {
+		rule.negate = true
+		p = p[1:]
+	}
+
+	matcher, err := dotignore.NewPatternMatcher([]string{p})
+	if err != nil {
+		return fmt.Errorf("invalid ignore pattern %s: %w", rule, err)
+	}
+	rule.matcher = matcher
+	m.rules = append(m.rules, rule)
+	return nil
+}
+
+// match reports whether relPath is ignored and the rule which decided it,
+// rule is nil when no rule matched.
+func (m *ignoreMatcher) match(relPath string) (bool, *ignoreRule) {
+	var last *ignoreRule
+	for _, rule := range m.rules {
+		if ok, _ := rule.matcher.Matches(relPath); ok {
+			last = rule
+		}
+	}
+	return last != nil && !last.negate, last
+}
+
+// explainPath writes the decision made for relPath to w, if set.
+func explainPath(w io.Writer, relPath string, ignore bool, rule *ignoreRule, reason string) {
+	if w == nil {
+		return
+	}
+	status := "included"
+	if ignore {
+		status = "excluded"
+	}
+	switch {
+	case reason != "":
+	case rule != nil:
+		reason = rule.String()
+	default:
+		reason = "no rule matched"
+	}
+	fmt.Fprintf(w, "%s  %-40s  (%s)\n", status, relPath, reason)
 }
@@ -2,7 +2,9 @@ package pkg
 
 import (
 	"archive/zip"
+	"net"
 	"os"
+	"os/exec"
 	"path/filepath"
 	"strings"
 	"testing"
@@ -296,3 +298,268 @@ func TestZipWithExclusionsEmptyDirectory(t *testing.T) {
 		t.Errorf("Expected empty zip, but got %d files", len(zipReader.File))
 	}
 }
+
+func TestZipWithExclusionsVendor(t *testing.T) {
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go toolchain not available")
+	}
+
+	tempDir := t.TempDir()
+
+	// Create a module depending on a sibling module through a local replace,
+	// both used by a workspace
+	testProject := filepath.Join(tempDir, "app")
+	sharedModule := filepath.Join(tempDir, "shared")
+	for _, dir := range []string{testProject, sharedModule, filepath.Join(testProject, "vendor", "stale")} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatalf("Failed to create directory %s: %v", dir, err)
+		}
+	}
+
+	testFiles := map[string]string{
+		filepath.Join(sharedModule, "go.mod"):                 "module example.com/shared\n\ngo 1.21\n",
+		filepath.Join(sharedModule, "shared.go"):              "package shared\n\nfunc Hello() string { return \"hello\" }\n",
+		filepath.Join(testProject, "go.mod"):                  "module app\n\ngo 1.21\n\nrequire example.com/shared v0.0.0\n\nreplace example.com/shared => ../shared\n",
+		filepath.Join(testProject, "main.go"):                 "package main\n\nimport \"example.com/shared\"\n\nfunc main() { println(shared.Hello()) }\n",
+		filepath.Join(testProject, "vendor", "stale", "x.go"): "package stale\n",
+		filepath.Join(tempDir, "go.work"):                     "go 1.21\n\nuse (\n\t./app\n\t./shared\n)\n",
+	}
+	for filePath, content := range testFiles {
+		if err := os.WriteFile(filePath, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to create file %s: %v", filePath, err)
+		}
+	}
+
+	zipPath := filepath.Join(tempDir, "vendor.zip")
+	if err := ZipWithExclusions(testProject, zipPath, WithVendor()); err != nil {
+		t.Fatalf("ZipWithExclusions failed: %v", err)
+	}
+
+	zipContents := readZipNames(t, zipPath)
+
+	expectedFiles := []string{"go.mod", "main.go", "vendor/modules.txt", "vendor/example.com/shared/shared.go"}
+	for _, expectedFile := range expectedFiles {
+		if !zipContents[expectedFile] {
+			t.Errorf("Expected file %s is missing from zip", expectedFile)
+		}
+	}
+	if zipContents["vendor/stale/x.go"] {
+		t.Error("Stale vendor directory should be replaced")
+	}
+
+	// Vendoring requires a Go module
+	noModule := filepath.Join(tempDir, "nomodule")
+	if err := os.MkdirAll(noModule, 0755); err != nil {
+		t.Fatalf("Failed to create directory %s: %v", noModule, err)
+	}
+	noModuleFile := filepath.Join(noModule, "main.go")
+	if err := os.WriteFile(noModuleFile, []byte("package main\n\nfunc main() {}\n"), 0644); err != nil {
+		t.Fatalf("Failed to create file %s: %v", noModuleFile, err)
+	}
+	if err := ZipWithExclusions(noModule, zipPath, WithVendor()); err == nil || !strings.Contains(err.Error(), "no go.mod found") {
+		t.Errorf("Expected a missing go.mod error when vendoring a directory without go.mod, got %v", err)
+	}
+	if err := ZipGoFiles([]string{noModuleFile}, zipPath, WithVendor()); err == nil || !strings.Contains(err.Error(), "not part of a Go module") {
+		t.Errorf("Expected a not part of a Go module error when vendoring files without go.mod, got %v", err)
+	}
+}
+
+func TestZipWithExclusionsSizeLimits(t *testing.T) {
+	tempDir := t.TempDir()
+
+	testProject := filepath.Join(tempDir, "large_project")
+	if err := os.MkdirAll(testProject, 0755); err != nil {
+		t.Fatalf("Failed to create test project: %v", err)
+	}
+
+	testFiles := map[string]string{
+		filepath.Join(testProject, "main.go"):     "package main\n",
+		filepath.Join(testProject, "dataset.bin"): strings.Repeat("x", 4096),
+	}
+	for filePath, content := range testFiles {
+		if err := os.WriteFile(filePath, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to create file %s: %v", filePath, err)
+		}
+	}
+
+	zipPath := filepath.Join(tempDir, "large.zip")
+
+	err := ZipWithExclusions(testProject, zipPath, WithMaxFileSize(1024))
+	if err == nil || !strings.Contains(err.Error(), "dataset.bin") {
+		t.Errorf("Expected max file size error for dataset.bin, got %v", err)
+	}
+
+	err = ZipWithExclusions(testProject, zipPath, WithMaxArchiveSize(64))
+	if err == nil {
+		t.Error("Expected error when the archive exceeds the max size")
+	}
+
+	err = ZipWithExclusions(testProject, zipPath, WithMaxFileSize(8192), WithMaxArchiveSize(1<<20), WithLargestFiles(1))
+	if err != nil {
+		t.Errorf("ZipWithExclusions failed within limits: %v", err)
+	}
+}
+
+func TestZipWithExclusionsExplain(t *testing.T) {
+	tempDir := t.TempDir()
+
+	testProject := filepath.Join(tempDir, "explain_project")
+	if err := os.MkdirAll(filepath.Join(testProject, "temp"), 0755); err != nil {
+		t.Fatalf("Failed to create test project: %v", err)
+	}
+
+	testFiles := map[string]string{
+		filepath.Join(testProject, ".gitignore"):        "# comment\n*.log\n!keep.log\ntemp/\n",
+		filepath.Join(testProject, "main.go"):           "package main\n",
+		filepath.Join(testProject, "debug.log"):         "debug",
+		filepath.Join(testProject, "keep.log"):          "keep",
+		filepath.Join(testProject, ".env"):              "ENV_VAR=value",
+		filepath.Join(testProject, "temp", "cache.txt"): "cache",
+	}
+	for filePath, content := range testFiles {
+		if err := os.WriteFile(filePath, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to create file %s: %v", filePath, err)
+		}
+	}
+
+	var explain strings.Builder
+	zipPath := filepath.Join(tempDir, "explain.zip")
+	if err := ZipWithExclusions(testProject, zipPath, WithExplain(&explain)); err != nil {
+		t.Fatalf("ZipWithExclusions failed: %v", err)
+	}
+
+	expectedLines := map[string]string{
+		"debug.log": "excluded (.gitignore:2 *.log)",
+		"keep.log":  "included (.gitignore:3 !keep.log)",
+		"temp/":     "excluded (.gitignore:4 temp/)",
+		".env":      "excluded (builtin .env)",
+		"main.go":   "included (no rule matched)",
+	}
+	for _, line := range strings.Split(strings.TrimSpace(explain.String()), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 3 {
+			t.Fatalf("Unexpected explain line %q", line)
+		}
+		want, ok := expectedLines[fields[1]]
+		if !ok {
+			continue
+		}
+		if got := fields[0] + " " + strings.Join(fields[2:], " "); got != want {
+			t.Errorf("Explain for %s = %q, want %q", fields[1], got, want)
+		}
+		delete(expectedLines, fields[1])
+	}
+	for relPath := range expectedLines {
+		t.Errorf("Missing explain line for %s", relPath)
+	}
+
+	zipContents := readZipNames(t, zipPath)
+	if !zipContents["keep.log"] || zipContents["debug.log"] {
+		t.Errorf("Negated pattern not applied, got %v", zipContents)
+	}
+}
+
+func TestZipWithExclusionsSymlinks(t *testing.T) {
+	tempDir := t.TempDir()
+
+	testProject := filepath.Join(tempDir, "link_project")
+	if err := os.MkdirAll(filepath.Join(testProject, "data"), 0755); err != nil {
+		t.Fatalf("Failed to create test project: %v", err)
+	}
+
+	testFiles := map[string]string{
+		filepath.Join(testProject, "main.go"):          "package main\n",
+		filepath.Join(testProject, "data", "dict.txt"): "words",
+		filepath.Join(tempDir, "outside.txt"):          "secret",
+	}
+	for filePath, content := range testFiles {
+		if err := os.WriteFile(filePath, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to create file %s: %v", filePath, err)
+		}
+	}
+	links := map[string]string{
+		filepath.Join(testProject, "alias.go"): "main.go",
+		filepath.Join(testProject, "assets"):   "data",
+		filepath.Join(testProject, "broken"):   "missing.txt",
+	}
+	for link, target := range links {
+		if err := os.Symlink(target, link); err != nil {
+			t.Skipf("Symlinks not supported: %v", err)
+		}
+	}
+
+	// A unix socket is not a regular file and must be skipped
+	if l, err := net.Listen("unix", filepath.Join(testProject, "app.sock")); err == nil {
+		defer l.Close()
+	}
+
+	zipPath := filepath.Join(tempDir, "links.zip")
+
+	if err := ZipWithExclusions(testProject, zipPath); err != nil {
+		t.Fatalf("ZipWithExclusions failed: %v", err)
+	}
+	zipContents := readZipNames(t, zipPath)
+	for _, expectedFile := range []string{"main.go", "alias.go", "data/dict.txt", "assets/dict.txt"} {
+		if !zipContents[expectedFile] {
+			t.Errorf("Expected file %s is missing from zip", expectedFile)
+		}
+	}
+	for _, excludedFile := range []string{"broken", "app.sock"} {
+		if zipContents[excludedFile] {
+			t.Errorf("Excluded file %s should not be in zip", excludedFile)
+		}
+	}
+
+	if err := ZipWithExclusions(testProject, zipPath, WithSymlinks(SymlinkStore)); err != nil {
+		t.Fatalf("ZipWithExclusions failed: %v", err)
+	}
+	zipReader, err := zip.OpenReader(zipPath)
+	if err != nil {
+		t.Fatalf("Failed to open zip file: %v", err)
+	}
+	for _, f := range zipReader.File {
+		if f.Name == "assets" && f.Mode()&os.ModeSymlink == 0 {
+			t.Error("Expected assets to be stored as a symlink")
+		}
+		if strings.HasPrefix(f.Name, "assets/") {
+			t.Errorf("Symlinked directory should not be followed, found %s", f.Name)
+		}
+	}
+	zipReader.Close()
+
+	if err := ZipWithExclusions(testProject, zipPath, WithSymlinks(SymlinkReject)); err == nil {
+		t.Error("Expected error when symlinks are rejected")
+	}
+
+	if err := os.Symlink(filepath.Join(tempDir, "outside.txt"), filepath.Join(testProject, "outside.txt")); err != nil {
+		t.Fatalf("Failed to create symlink: %v", err)
+	}
+	if err := ZipWithExclusions(testProject, zipPath); err == nil {
+		t.Error("Expected error when a symlink points outside the source tree")
+	}
+	os.Remove(filepath.Join(testProject, "outside.txt"))
+
+	if err := os.Symlink("..", filepath.Join(testProject, "data", "loop")); err != nil {
+		t.Fatalf("Failed to create symlink: %v", err)
+	}
+	if err := ZipWithExclusions(testProject, zipPath); err == nil {
+		t.Error("Expected error when a symlink creates a cycle")
+	}
+	os.Remove(filepath.Join(testProject, "data", "loop"))
+
+	// Two directories linking to each other
+	for _, dir := range []string{"a", "b"} {
+		if err := os.MkdirAll(filepath.Join(testProject, dir), 0755); err != nil {
+			t.Fatalf("Failed to create directory %s: %v", dir, err)
+		}
+	}
+	if err := os.Symlink("../b", filepath.Join(testProject, "a", "l")); err != nil {
+		t.Fatalf("Failed to create symlink: %v", err)
+	}
+	if err := os.Symlink("../a", filepath.Join(testProject, "b", "m")); err != nil {
+		t.Fatalf("Failed to create symlink: %v", err)
+	}
+	if err := ZipWithExclusions(testProject, zipPath, WithMaxArchiveSize(0)); err == nil || !strings.Contains(err.Error(), "creates a cycle") {
+		t.Errorf("Expected a cycle error for directories linking to each other, got %v", err)
+	}
+}
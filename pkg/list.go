@@ -0,0 +1,103 @@
+package pkg
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// listTools sends the list request and returns the response of each zone.
+func (c *command) listTools() ([]Response, error) {
+	return collect(c, TAG_REQUEST_LIST, &ReqMsgList{})
+}
+
+// collect sends a request and returns the final response of each zone,
+// including the errors, for the commands printing them as a table instead
+// of line by line.
+func collect[T any](c *command, tag uint32, reqMsg *T) ([]Response, error) {
+	var (
+		mu        sync.Mutex
+		responses = make(map[string]Response)
+	)
+	out := c.out
+	c.out = io.Discard
+	c.awaitAll = true
+	c.onResponse = func(res *Response) {
+		// the progress messages of a zone are not results
+		if !res.Done && res.Error == "" {
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		responses[res.MeshZone] = *res
+	}
+	defer func() { c.out, c.onResponse, c.awaitAll = out, nil, false }()
+
+	if err := send(c, tag, reqMsg, nil, nil); err != nil {
+		return nil, err
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	result := make([]Response, 0, len(responses))
+	for _, zone := range slices.Sorted(maps.Keys(responses)) {
+		result = append(result, responses[zone])
+	}
+	return result, nil
+}
+
+// printToolList prints a row per deployed tool and zone, followed by the
+// errors of the zones.
+func printToolList(w io.Writer, responses []Response) {
+	type row struct {
+		zone string
+		tool ListedTool
+	}
+	var (
+		rows     []row
+		failures []string
+	)
+	for _, res := range responses {
+		if res.Error != "" {
+			failures = append(failures, fmt.Sprintf("[%s] Error: %s", res.MeshZone, res.Error))
+			continue
+		}
+		var list ResMsgList
+		if err := json.Unmarshal([]byte(res.Msg), &list); err != nil {
+			failures = append(failures, fmt.Sprintf("[%s] Error: invalid list: %v", res.MeshZone, err))
+			continue
+		}
+		for _, t := range list.Tools {
+			rows = append(rows, row{zone: res.MeshZone, tool: t})
+		}
+	}
+	slices.SortFunc(rows, func(a, b row) int {
+		return cmp.Or(cmp.Compare(a.tool.Name, b.tool.Name), cmp.Compare(a.zone, b.zone))
+	})
+
+	if len(rows) == 0 {
+		fmt.Fprintln(w, "No tools deployed")
+	} else {
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "TOOL\tZONE\tSTATUS\tVERSION\tDEPLOYED")
+		for _, r := range rows {
+			deployed := "-"
+			if !r.tool.DeployedAt.IsZero() {
+				deployed = r.tool.DeployedAt.Local().Format(time.DateTime)
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", r.tool.Name, r.zone, r.tool.Status, cmp.Or(r.tool.Version, "-"), deployed)
+		}
+		tw.Flush()
+	}
+
+	slices.Sort(failures)
+	for _, e := range failures {
+		fmt.Fprintln(w, e)
+	}
+}
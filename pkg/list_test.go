@@ -0,0 +1,32 @@
+package pkg
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPrintToolList(t *testing.T) {
+	deployedAt := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	responses := []Response{
+		{MeshZone: "zone-b", Done: true, Msg: `{"tools":[{"name":"weather","status":"running","version":"v3","deployed_at":"2026-03-01T12:00:00Z"}]}`},
+		{MeshZone: "zone-a", Done: true, Msg: `{"tools":[{"name":"weather","status":"building"},{"name":"search","status":"running","version":"v1"}]}`},
+		{MeshZone: "zone-c", Done: true, Error: "unauthorized"},
+	}
+
+	var out bytes.Buffer
+	printToolList(&out, responses)
+
+	expected := strings.Join([]string{
+		"TOOL     ZONE    STATUS    VERSION  DEPLOYED",
+		"search   zone-a  running   v1       -",
+		"weather  zone-a  building  -        -",
+		"weather  zone-b  running   v3       " + deployedAt.Local().Format(time.DateTime),
+		"[zone-c] Error: unauthorized",
+		"",
+	}, "\n")
+	if out.String() != expected {
+		t.Errorf("Tool list =\n%s\nwant\n%s", out.String(), expected)
+	}
+}
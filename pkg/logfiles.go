@@ -0,0 +1,72 @@
+package pkg
+
+import (
+	"cmp"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+// logFiles writes the log lines of each zone to its own file in dir, rotated
+// once it reaches maxSize megabytes and keeping maxBackups rotated files.
+type logFiles struct {
+	dir        string
+	tool       string
+	maxSize    int
+	maxBackups int
+	files      map[string]*lumberjack.Logger
+}
+
+func newLogFiles(dir, tool string, maxSize, maxBackups int) (*logFiles, error) {
+	if maxSize <= 0 {
+		return nil, fmt.Errorf("invalid --save-max-size %d, it must be positive", maxSize)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &logFiles{
+		dir:        dir,
+		tool:       tool,
+		maxSize:    maxSize,
+		maxBackups: maxBackups,
+		files:      make(map[string]*lumberjack.Logger),
+	}, nil
+}
+
+// path returns the file of zone, named after the tool and the zone.
+func (f *logFiles) path(zone string) string {
+	name := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_', r == '.':
+			return r
+		default:
+			return '_'
+		}
+	}, f.tool+"-"+cmp.Or(zone, "default"))
+	return filepath.Join(f.dir, name+".log")
+}
+
+// writer returns the file of zone, opened on the first write.
+func (f *logFiles) writer(zone string) io.Writer {
+	l, ok := f.files[zone]
+	if !ok {
+		l = &lumberjack.Logger{
+			Filename:   f.path(zone),
+			MaxSize:    f.maxSize,
+			MaxBackups: f.maxBackups,
+			LocalTime:  true,
+		}
+		f.files[zone] = l
+	}
+	return l
+}
+
+func (f *logFiles) close() {
+	for _, l := range f.files {
+		l.Close()
+	}
+}
@@ -0,0 +1,181 @@
+package pkg
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/yomorun/yomo/core/ylog"
+)
+
+// redacted replaces secret values in logged payloads.
+const redacted = "<redacted>"
+
+// sensitiveKeys are the payload keys, lower cased, whose values are redacted.
+var sensitiveKeys = []string{"secret", "token", "password", "credential", "api_key", "apikey", "authorization"}
+
+// newLogger returns the logger of the yomo clients and of the wire payloads.
+// verbose logs at info level and debug at debug level, to stderr or to file,
+// which is returned to be closed once the command is done. Without either,
+// the logger of yomo configured by the YOMO_LOG_* environment variables is
+// returned.
+func newLogger(verbose, debug bool, file string) (*slog.Logger, *os.File, error) {
+	if !verbose && !debug {
+		return ylog.Default(), nil, nil
+	}
+
+	var (
+		w       io.Writer = os.Stderr
+		logFile *os.File
+	)
+	if file != "" {
+		f, err := os.OpenFile(file, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return nil, nil, err
+		}
+		w, logFile = f, f
+	}
+
+	level := slog.LevelInfo
+	if debug {
+		level = slog.LevelDebug
+	}
+	return slog.New(slog.NewTextHandler(w, &slog.HandlerOptions{Level: level})), logFile, nil
+}
+
+// closeLogFile flushes and closes the --log-file, if any.
+func (c *command) closeLogFile() {
+	if c.logFile == nil {
+		return
+	}
+	c.logFile.Sync()
+	c.logFile.Close()
+	c.logFile = nil
+}
+
+// tagName names a request or response tag in the logs.
+func tagName(tag uint32) string {
+	kind, reqTag := "request", tag
+	if tag >= ResponseTag(TAG_REQUEST_HELLO) {
+		// responses are tagged ResponseTag of their request
+		kind, reqTag = "response", tag-(ResponseTag(tag)-tag)
+	}
+	name, ok := capabilities[reqTag]
+	if reqTag == TAG_REQUEST_HELLO {
+		name, ok = "hello", true
+	}
+	if !ok {
+		name = "unknown"
+	}
+	return fmt.Sprintf("%s %s (%#x)", name, kind, tag)
+}
+
+// logRequest logs an outgoing request, with its redacted payload at debug
+// level. wire is the size of the encoded payload.
+func (c *command) logRequest(tag uint32, req any, wire int) {
+	if !c.logger.Enabled(context.Background(), slog.LevelInfo) {
+		return
+	}
+	attrs := []any{"tag", tagName(tag), "target", c.tid, "sfn_name", c.tool, "bytes", wire, "codec", c.codec.Name()}
+	if c.encoding != "" {
+		attrs = append(attrs, "encoding", c.encoding)
+	}
+	if c.logger.Enabled(context.Background(), slog.LevelDebug) {
+		attrs = append(attrs, "payload", redactRequest(req))
+	}
+	c.logger.Info("send", attrs...)
+}
+
+// logResponse logs an incoming response, with its message at debug level.
+// wire is the size of the encoded payload.
+func (c *command) logResponse(tag uint32, res *Response, wire int) {
+	if !c.logger.Enabled(context.Background(), slog.LevelInfo) {
+		return
+	}
+	attrs := []any{"tag", tagName(tag), "zone", res.MeshZone, "done", res.Done, "bytes", wire}
+	if res.Error != "" {
+		attrs = append(attrs, "error", res.Error)
+	}
+	if c.logger.Enabled(context.Background(), slog.LevelDebug) {
+		attrs = append(attrs, "msg", res.Msg)
+	}
+	c.logger.Info("receive", attrs...)
+}
+
+// redactRequest renders req as JSON with the binary body, the values of
+// environment variables and the values of sensitive keys redacted.
+func redactRequest(req any) string {
+	var body []byte
+	if env, ok := req.(binaryEnvelope); ok {
+		if bm := env.binaryMessage(); bm != nil {
+			body = bm.Body()
+			bm.SetBody(nil)
+			defer bm.SetBody(body)
+		}
+	}
+
+	data, err := json.Marshal(req)
+	if err != nil {
+		return err.Error()
+	}
+	var v any
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err.Error()
+	}
+	v = redactValue("", v)
+	envelope, _ := v.(map[string]any)
+	if m, ok := envelope["msg"].(map[string]any); ok && body != nil {
+		m["body"] = fmt.Sprintf("<%s redacted>", formatSize(int64(len(body))))
+	}
+
+	var buf strings.Builder
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return err.Error()
+	}
+	return strings.TrimSuffix(buf.String(), "\n")
+}
+
+func redactValue(key string, v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for k, value := range v {
+			v[k] = redactValue(k, value)
+		}
+		return v
+	case []any:
+		for i, value := range v {
+			if s, ok := value.(string); ok && key == "envs" {
+				// keep the variable names, they help debugging
+				if name, _, found := strings.Cut(s, "="); found {
+					v[i] = name + "=" + redacted
+				}
+				continue
+			}
+			v[i] = redactValue(key, value)
+		}
+		return v
+	case nil:
+		return nil
+	default:
+		if isSensitive(key) {
+			return redacted
+		}
+		return v
+	}
+}
+
+func isSensitive(key string) bool {
+	key = strings.ToLower(key)
+	for _, s := range sensitiveKeys {
+		if strings.Contains(key, s) {
+			return true
+		}
+	}
+	return false
+}
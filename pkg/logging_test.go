@@ -0,0 +1,70 @@
+package pkg
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestRedactRequest(t *testing.T) {
+	envs := []string{"API_KEY=sup3r", "DEBUG"}
+	tests := []struct {
+		name     string
+		req      any
+		expected []string
+	}{
+		{
+			name:     "upload",
+			req:      &Request[ReqMsgUpload]{Target: "t", Msg: &ReqMsgUpload{ZipData: make([]byte, 2048), Runtime: "node"}},
+			expected: []string{`"body":"<2.0 KiB redacted>"`, `"runtime":"node"`},
+		},
+		{
+			name:     "create",
+			req:      &Request[ReqMsgCreate]{Target: "t", Msg: &ReqMsgCreate{Envs: &envs}},
+			expected: []string{`"envs":["API_KEY=<redacted>","DEBUG"]`},
+		},
+		{
+			name:     "invoke",
+			req:      &Request[ReqMsgInvoke]{Target: "t", Msg: &ReqMsgInvoke{Args: json.RawMessage(`{"city":"Paris","auth":{"api_key":"sup3r"}}`)}},
+			expected: []string{`"city":"Paris"`, `"api_key":"<redacted>"`},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := redactRequest(tt.req)
+			for _, expected := range tt.expected {
+				if !strings.Contains(got, expected) {
+					t.Errorf("redactRequest() = %s, want it to contain %s", got, expected)
+				}
+			}
+			if strings.Contains(got, "sup3r") || strings.Contains(got, `"zip_data":"`) {
+				t.Errorf("redactRequest() = %s leaks a secret or the archive", got)
+			}
+		})
+	}
+
+	upload := &ReqMsgUpload{ZipData: []byte("zip")}
+	redactRequest(&Request[ReqMsgUpload]{Msg: upload})
+	if string(upload.ZipData) != "zip" {
+		t.Errorf("redactRequest() did not restore the archive, got %q", upload.ZipData)
+	}
+}
+
+func TestTagName(t *testing.T) {
+	tests := []struct {
+		tag      uint32
+		expected string
+	}{
+		{TAG_REQUEST_HELLO, "hello request (0xe200)"},
+		{TAG_REQUEST_UPLOAD, "upload request (0xe201)"},
+		{TAG_RESPONSE_LOGS, "logs response (0xf207)"},
+		{0xE2FF, "unknown request (0xe2ff)"},
+	}
+
+	for _, tt := range tests {
+		if got := tagName(tt.tag); got != tt.expected {
+			t.Errorf("tagName(%#x) = %s, want %s", tt.tag, got, tt.expected)
+		}
+	}
+}
@@ -0,0 +1,370 @@
+package pkg
+
+import (
+	"cmp"
+	"container/heap"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// logsResubscribeInterval is the interval of the logs requests, renewing
+// the subscription of the zones.
+var logsResubscribeInterval = 15 * time.Second
+
+// logsDrainDelay is how long the lines trailing the end of a log stream are
+// still printed.
+const logsDrainDelay = 200 * time.Millisecond
+
+// logsRangeCapability is announced in the hello response by servers honoring
+// the Since, Until and NoFollow fields of the logs requests. Others would
+// stream the tail forever.
+const logsRangeCapability = "logs-range"
+
+// supportsLogsRange reports whether the logs can be read from a time range
+// and without following them. Like supportsZones, it is not assumed when the
+// handshake failed.
+func (c *command) supportsLogsRange() bool {
+	return c.hello != nil && slices.Contains(c.hello.Capabilities, logsRangeCapability)
+}
+
+const (
+	outputText = "text"
+	outputJSON = "json"
+
+	logTimeFormat = "2006-01-02 15:04:05.000"
+)
+
+// parseLogTime parses the --since and --until flags, a duration before now
+// or an RFC 3339 time. An empty s is the zero time.
+func parseLogTime(s string, now time.Time) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if d, err := time.ParseDuration(s); err == nil && d >= 0 {
+		return now.Add(-d), nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time %q, use a duration like 2h or an RFC 3339 time", s)
+	}
+	return t, nil
+}
+
+// logRecord is a log line as printed by `yc logs --output json`.
+type logRecord struct {
+	Seq      uint64    `json:"seq,omitempty"`
+	Time     time.Time `json:"time"`
+	Zone     string    `json:"zone"`
+	Instance string    `json:"instance"`
+	Level    string    `json:"level"`
+	Stream   string    `json:"stream"`
+	Message  string    `json:"message"`
+}
+
+// parseLogLine returns the log line carried by res, which is structured or
+// plain text for servers predating structured logs.
+func parseLogLine(res *Response) logRecord {
+	var msg ResMsgLogs
+	if !strings.HasPrefix(res.Msg, "{") || json.Unmarshal([]byte(res.Msg), &msg) != nil {
+		msg = ResMsgLogs{Log: res.Msg}
+	}
+	return logRecord{
+		Seq:      msg.Seq,
+		Time:     msg.Time,
+		Zone:     res.MeshZone,
+		Instance: msg.Instance,
+		Level:    strings.ToLower(msg.Level),
+		Stream:   cmp.Or(msg.Stream, LogStdout),
+		Message:  strings.TrimRight(msg.Log, "\n"),
+	}
+}
+
+// logPrinter prints log lines as aligned, colored columns or as NDJSON. It
+// drops the lines already received from a zone, and with a reorder window,
+// holds the lines for that long to print them ordered by timestamp.
+type logPrinter struct {
+	out    io.Writer
+	json   bool
+	color  bool
+	window time.Duration
+	// files receive the lines instead of out when set, see `yc logs --save`
+	files *logFiles
+
+	mu sync.Mutex
+	// widths of the zone and instance columns, growing with the lines seen
+	zoneWidth, instanceWidth int
+	// seqs are the Seq received from each instance, keyed by zone and
+	// instance
+	seqs    map[seqKey]*seqWindow
+	pending logHeap
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+// newLogPrinter returns the printer of output, colored when out is a
+// terminal and NO_COLOR is not set. Lines are reordered within window when
+// it is positive, the printer must then be closed to print the last lines.
+func newLogPrinter(out io.Writer, output string, window time.Duration) (*logPrinter, error) {
+	if output != outputText && output != outputJSON {
+		return nil, fmt.Errorf("invalid --output %q, use %s or %s", output, outputText, outputJSON)
+	}
+	f, ok := out.(*os.File)
+	color := ok && isTerminal(f) && os.Getenv("NO_COLOR") == ""
+	p := &logPrinter{
+		out:    out,
+		json:   output == outputJSON,
+		color:  color,
+		window: window,
+		seqs:   make(map[seqKey]*seqWindow),
+	}
+	if window > 0 {
+		p.stop, p.done = make(chan struct{}), make(chan struct{})
+		go p.flushLoop()
+	}
+	return p, nil
+}
+
+// lastSeqs returns the highest Seq received from each instance since its
+// last restart, keyed by zone and instance. The lines before it were sent by
+// the instance already, even those still in flight.
+func (p *logPrinter) lastSeqs() map[string]map[string]uint64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	cursors := make(map[string]map[string]uint64)
+	for key, w := range p.seqs {
+		if cursors[key.zone] == nil {
+			cursors[key.zone] = make(map[string]uint64)
+		}
+		cursors[key.zone][key.instance] = w.max
+	}
+	return cursors
+}
+
+func (p *logPrinter) print(res *Response) {
+	r := parseLogLine(res)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if r.Seq > 0 {
+		key := seqKey{r.Zone, r.Instance}
+		w, ok := p.seqs[key]
+		if !ok {
+			w = &seqWindow{seen: make(map[uint64]struct{})}
+			p.seqs[key] = w
+		}
+		if !w.add(r.Seq) {
+			// replayed by a re-subscription
+			return
+		}
+	}
+
+	if p.window <= 0 {
+		p.write(r)
+		return
+	}
+	heap.Push(&p.pending, pendingLog{logRecord: r, received: time.Now()})
+}
+
+// flushLoop prints the pending lines held for the reorder window.
+func (p *logPrinter) flushLoop() {
+	defer close(p.done)
+	ticker := time.NewTicker(max(p.window/4, 10*time.Millisecond))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			p.flush(time.Now().Add(-p.window))
+		case <-p.stop:
+			p.flush(time.Time{})
+			return
+		}
+	}
+}
+
+// flush prints the pending lines received before deadline, every pending
+// line when deadline is zero. Lines are popped in timestamp order, a line
+// received before deadline flushes the earlier lines with it.
+func (p *logPrinter) flush(deadline time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for p.pending.Len() > 0 {
+		if !deadline.IsZero() && !p.pending.hasReceivedBefore(deadline) {
+			return
+		}
+		p.write(heap.Pop(&p.pending).(pendingLog).logRecord)
+	}
+}
+
+// close prints the pending lines and closes the files.
+func (p *logPrinter) close() {
+	if p.stop != nil {
+		select {
+		case <-p.done:
+		default:
+			close(p.stop)
+			<-p.done
+		}
+	}
+	if p.files != nil {
+		p.mu.Lock()
+		p.files.close()
+		p.mu.Unlock()
+	}
+}
+
+// write prints r, p.mu must be held.
+func (p *logPrinter) write(r logRecord) {
+	out, color := p.out, p.color
+	if p.files != nil {
+		out, color = p.files.writer(r.Zone), false
+	}
+	if p.json {
+		buf, _ := json.Marshal(r)
+		fmt.Fprintf(out, "%s\n", buf)
+		return
+	}
+
+	p.zoneWidth = max(p.zoneWidth, len(r.Zone))
+	p.instanceWidth = max(p.instanceWidth, len(r.Instance))
+
+	ts := strings.Repeat(" ", len(logTimeFormat))
+	if !r.Time.IsZero() {
+		ts = r.Time.Local().Format(logTimeFormat)
+	}
+	level := fmt.Sprintf("%-5s", strings.ToUpper(r.Level))
+	stream := "out"
+	if r.Stream == LogStderr {
+		stream = "err"
+	}
+	if color {
+		ts = colorGray + ts + colorReset
+		level = levelColor(r.Level) + level + colorReset
+		if r.Stream == LogStderr {
+			stream = colorRed + stream + colorReset
+		}
+	}
+	fmt.Fprintf(out, "%s %-*s %-*s %s %s %s\n", ts, p.zoneWidth, r.Zone, p.instanceWidth, r.Instance, level, stream, r.Message)
+}
+
+// seqWindowSize is the number of Seq remembered per instance. A Seq older
+// than the window can't be a replay, the zones resume after the cursor, so
+// the instance restarted and counts from 1 again.
+const seqWindowSize = 1024
+
+// seqKey identifies the instance of a zone which sent a line.
+type seqKey struct {
+	zone, instance string
+}
+
+// seqWindow remembers the Seq received from an instance. The lines of a zone
+// are handled concurrently, so they are not received in Seq order.
+type seqWindow struct {
+	max  uint64
+	seen map[uint64]struct{}
+}
+
+// add records seq and reports whether it was not received before.
+func (w *seqWindow) add(seq uint64) bool {
+	if seq+seqWindowSize <= w.max {
+		clear(w.seen)
+		w.max = 0
+	}
+	if _, ok := w.seen[seq]; ok {
+		return false
+	}
+	w.seen[seq] = struct{}{}
+	w.max = max(w.max, seq)
+
+	if len(w.seen) > 2*seqWindowSize {
+		for s := range w.seen {
+			if s+seqWindowSize <= w.max {
+				delete(w.seen, s)
+			}
+		}
+	}
+	return true
+}
+
+// pendingLog is a line held in the reorder window.
+type pendingLog struct {
+	logRecord
+	received time.Time
+}
+
+// at is the time the line is ordered by, lines without timestamp are
+// ordered by reception.
+func (l pendingLog) at() time.Time {
+	if l.Time.IsZero() {
+		return l.received
+	}
+	return l.Time
+}
+
+// logHeap orders the pending lines by time, then zone and Seq.
+type logHeap []pendingLog
+
+func (h logHeap) Len() int { return len(h) }
+
+func (h logHeap) Less(i, j int) bool {
+	if c := h[i].at().Compare(h[j].at()); c != 0 {
+		return c < 0
+	}
+	if h[i].Zone != h[j].Zone {
+		return h[i].Zone < h[j].Zone
+	}
+	return h[i].Seq < h[j].Seq
+}
+
+func (h logHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+
+func (h *logHeap) Push(x any) { *h = append(*h, x.(pendingLog)) }
+
+func (h *logHeap) Pop() any {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
+
+// hasReceivedBefore reports whether a pending line was received before t.
+func (h logHeap) hasReceivedBefore(t time.Time) bool {
+	for _, l := range h {
+		if l.received.Before(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// printError prints the error of a zone, as a JSON object with --output json.
+func (p *logPrinter) printError(res *Response) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.json {
+		buf, _ := json.Marshal(map[string]string{"zone": res.MeshZone, "error": res.Error})
+		fmt.Fprintf(p.out, "%s\n", buf)
+		return
+	}
+	fmt.Fprintf(p.out, "[%s] Error: %s\n", res.MeshZone, res.Error)
+}
+
+func levelColor(level string) string {
+	switch level {
+	case "error", "fatal", "panic":
+		return colorRed
+	case "warn", "warning":
+		return colorYellow
+	case "debug", "trace":
+		return colorGray
+	default:
+		return colorGreen
+	}
+}
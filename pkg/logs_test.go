@@ -0,0 +1,275 @@
+package pkg
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestParseLogLine(t *testing.T) {
+	at := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		msg      string
+		expected logRecord
+	}{
+		{
+			msg:      `{"log":"ready\n","time":"2026-03-01T12:00:00Z","instance":"i-1","level":"WARN","stream":"stderr"}`,
+			expected: logRecord{Time: at, Zone: "zone-a", Instance: "i-1", Level: "warn", Stream: LogStderr, Message: "ready"},
+		},
+		{
+			msg:      "plain text from an older server",
+			expected: logRecord{Zone: "zone-a", Stream: LogStdout, Message: "plain text from an older server"},
+		},
+		{
+			msg:      "{not json",
+			expected: logRecord{Zone: "zone-a", Stream: LogStdout, Message: "{not json"},
+		},
+	}
+
+	for _, tt := range tests {
+		got := parseLogLine(&Response{MeshZone: "zone-a", Msg: tt.msg})
+		if got != tt.expected {
+			t.Errorf("parseLogLine(%q) = %+v, want %+v", tt.msg, got, tt.expected)
+		}
+	}
+}
+
+func TestLogPrinterAlignsColumns(t *testing.T) {
+	var out bytes.Buffer
+	p, err := newLogPrinter(&out, outputText, 0)
+	if err != nil {
+		t.Fatalf("newLogPrinter failed: %v", err)
+	}
+	p.print(&Response{MeshZone: "zone-long", Msg: `{"log":"a","instance":"i-1","level":"info"}`})
+	p.print(&Response{MeshZone: "zone-b", Msg: `{"log":"b","instance":"i-2","level":"error","stream":"stderr"}`})
+
+	blank := strings.Repeat(" ", len(logTimeFormat))
+	expected := blank + " zone-long i-1 INFO  out a\n" + blank + " zone-b    i-2 ERROR err b\n"
+	if out.String() != expected {
+		t.Errorf("Log lines =\n%q\nwant\n%q", out.String(), expected)
+	}
+
+	if _, err := newLogPrinter(&out, "yaml", 0); err == nil {
+		t.Error("Expected error for an invalid output")
+	}
+}
+
+func TestLogPrinterDropsReplayedLines(t *testing.T) {
+	var out bytes.Buffer
+	p, _ := newLogPrinter(&out, outputJSON, 0)
+	for _, res := range []Response{
+		// lines of a zone are handled concurrently, out of order
+		{MeshZone: "zone-a", Msg: `{"seq":2,"log":"a2"}`},
+		{MeshZone: "zone-a", Msg: `{"seq":1,"log":"a1"}`},
+		{MeshZone: "zone-b", Msg: `{"seq":1,"log":"b1"}`},
+		// replayed after re-subscribing
+		{MeshZone: "zone-a", Msg: `{"seq":2,"log":"a2"}`},
+		{MeshZone: "zone-a", Msg: `{"seq":3,"log":"a3"}`},
+		// untracked lines are never dropped
+		{MeshZone: "zone-b", Msg: "plain"},
+		{MeshZone: "zone-b", Msg: "plain"},
+	} {
+		p.print(&res)
+	}
+
+	var messages []string
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		var r logRecord
+		json.Unmarshal([]byte(line), &r)
+		messages = append(messages, r.Message)
+	}
+	if got := strings.Join(messages, " "); got != "a2 a1 b1 a3 plain plain" {
+		t.Errorf("Printed lines %q, want %q", got, "a2 a1 b1 a3 plain plain")
+	}
+
+	cursors := p.lastSeqs()
+	if cursors["zone-a"][""] != 3 || cursors["zone-b"][""] != 1 {
+		t.Errorf("lastSeqs() = %v, want zone-a 3 and zone-b 1", cursors)
+	}
+}
+
+func TestSeqWindow(t *testing.T) {
+	w := &seqWindow{seen: make(map[uint64]struct{})}
+	for seq := uint64(1); seq <= 5*seqWindowSize; seq++ {
+		if !w.add(seq) {
+			t.Fatalf("add(%d) = false for a new Seq", seq)
+		}
+	}
+	if len(w.seen) > 2*seqWindowSize {
+		t.Errorf("Expected the window to be bounded, got %d Seq", len(w.seen))
+	}
+	if w.add(5*seqWindowSize) || w.add(4*seqWindowSize+1) {
+		t.Error("Expected replayed Seq to be rejected")
+	}
+
+	// older than the window, the instance restarted
+	if !w.add(1) || !w.add(2) || w.add(1) {
+		t.Error("Expected the Seq to restart from 1")
+	}
+	if w.max != 2 {
+		t.Errorf("Expected the window to restart, max is %d", w.max)
+	}
+}
+
+func TestLogPrinterAfterRestart(t *testing.T) {
+	var out bytes.Buffer
+	p, _ := newLogPrinter(&out, outputJSON, 0)
+	for _, res := range []Response{
+		{MeshZone: "zone-a", Msg: `{"seq":1,"log":"a1","instance":"i-1"}`},
+		{MeshZone: "zone-a", Msg: `{"seq":2,"log":"a2","instance":"i-1"}`},
+		{MeshZone: "zone-a", Msg: `{"seq":3,"log":"a3","instance":"i-1"}`},
+		// a new instance counts from 1 again
+		{MeshZone: "zone-a", Msg: `{"seq":1,"log":"b1","instance":"i-2"}`},
+		{MeshZone: "zone-a", Msg: `{"seq":2,"log":"b2","instance":"i-2"}`},
+		{MeshZone: "zone-a", Msg: `{"seq":2,"log":"b2","instance":"i-2"}`},
+	} {
+		p.print(&res)
+	}
+
+	if n := strings.Count(out.String(), "\n"); n != 5 {
+		t.Errorf("Expected 5 lines, got %q", out.String())
+	}
+	// each instance resumes after its own line
+	if cursors := p.lastSeqs(); cursors["zone-a"]["i-1"] != 3 || cursors["zone-a"]["i-2"] != 2 {
+		t.Errorf("lastSeqs() = %v, want i-1 3 and i-2 2 in zone-a", cursors)
+	}
+}
+
+func TestLogPrinterReorders(t *testing.T) {
+	var out syncBuffer
+	p, _ := newLogPrinter(&out, outputJSON, 50*time.Millisecond)
+	for _, res := range []Response{
+		{MeshZone: "zone-b", Msg: `{"seq":1,"log":"third","time":"2026-03-01T12:00:03Z"}`},
+		{MeshZone: "zone-a", Msg: `{"seq":1,"log":"first","time":"2026-03-01T12:00:01Z"}`},
+		{MeshZone: "zone-a", Msg: `{"seq":2,"log":"second","time":"2026-03-01T12:00:02Z"}`},
+	} {
+		p.print(&res)
+	}
+	if out.String() != "" {
+		t.Errorf("Expected lines to be held for the reorder window, got %q", out.String())
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for strings.Count(out.String(), "\n") < 3 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	p.close()
+
+	var messages []string
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		var r logRecord
+		json.Unmarshal([]byte(line), &r)
+		messages = append(messages, r.Message)
+	}
+	if got := strings.Join(messages, " "); got != "first second third" {
+		t.Errorf("Printed lines %q, want %q", got, "first second third")
+	}
+}
+
+func TestLogPrinterCloseFlushes(t *testing.T) {
+	var out syncBuffer
+	p, _ := newLogPrinter(&out, outputText, time.Hour)
+	p.print(&Response{MeshZone: "zone-a", Msg: "last words"})
+	p.close()
+	p.close()
+	if !strings.Contains(out.String(), "last words") {
+		t.Errorf("Expected close to print the pending lines, got %q", out.String())
+	}
+}
+
+// syncBuffer is a bytes.Buffer safe for concurrent use.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestParseLogTime(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		s        string
+		expected time.Time
+	}{
+		{"", time.Time{}},
+		{"2h", now.Add(-2 * time.Hour)},
+		{"90s", now.Add(-90 * time.Second)},
+		{"2026-02-28T08:30:00Z", time.Date(2026, 2, 28, 8, 30, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		got, err := parseLogTime(tt.s, now)
+		if err != nil {
+			t.Fatalf("parseLogTime(%q) failed: %v", tt.s, err)
+		}
+		if !got.Equal(tt.expected) {
+			t.Errorf("parseLogTime(%q) = %v, want %v", tt.s, got, tt.expected)
+		}
+	}
+
+	for _, s := range []string{"-2h", "yesterday", "2026-02-28"} {
+		if _, err := parseLogTime(s, now); err == nil {
+			t.Errorf("Expected error for %q", s)
+		}
+	}
+}
+
+func TestLogPrinterSavesZoneFiles(t *testing.T) {
+	dir := t.TempDir()
+	files, err := newLogFiles(dir, "my/tool", 1, 1)
+	if err != nil {
+		t.Fatalf("newLogFiles failed: %v", err)
+	}
+	var out bytes.Buffer
+	p, err := newLogPrinter(&out, outputJSON, 0)
+	if err != nil {
+		t.Fatalf("newLogPrinter failed: %v", err)
+	}
+	p.files = files
+	p.print(&Response{MeshZone: "zone-a", Msg: `{"seq":1,"log":"a1"}`})
+	p.print(&Response{MeshZone: "zone-b", Msg: `{"seq":1,"log":"b1"}`})
+	p.print(&Response{MeshZone: "zone-a", Msg: `{"seq":2,"log":"a2"}`})
+	p.close()
+
+	if out.Len() != 0 {
+		t.Errorf("Expected no output while saving, got %q", out.String())
+	}
+	for file, expected := range map[string]string{
+		"my_tool-zone-a.log": "a1 a2",
+		"my_tool-zone-b.log": "b1",
+	} {
+		buf, err := os.ReadFile(filepath.Join(dir, file))
+		if err != nil {
+			t.Fatalf("Failed to read %s: %v", file, err)
+		}
+		var got []string
+		for _, line := range strings.Split(strings.TrimSpace(string(buf)), "\n") {
+			var r logRecord
+			if err := json.Unmarshal([]byte(line), &r); err != nil {
+				t.Fatalf("Failed to decode %q: %v", line, err)
+			}
+			got = append(got, r.Message)
+		}
+		if strings.Join(got, " ") != expected {
+			t.Errorf("%s has lines %q, want %q", file, got, expected)
+		}
+	}
+
+	if _, err := newLogFiles(dir, "tool", 0, 1); err == nil {
+		t.Error("Expected error for a zero max size")
+	}
+}
@@ -0,0 +1,148 @@
+package pkg
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+const (
+	outputTable = "table"
+	outputChart = "chart"
+
+	// metricsPoints is the number of buckets of the series, the width of
+	// the sparklines
+	metricsPoints = 30
+)
+
+// sparks are the bars of the sparklines, from the lowest to the highest value.
+var sparks = []rune("▁▂▃▄▅▆▇█")
+
+// zoneMetrics are the metrics of a zone, or the error it answered.
+type zoneMetrics struct {
+	Zone  string `json:"zone"`
+	Error string `json:"error,omitempty"`
+	ResMsgMetrics
+}
+
+// parseMetrics returns the metrics of each zone, sorted by zone.
+func parseMetrics(responses []Response) []zoneMetrics {
+	metrics := make([]zoneMetrics, 0, len(responses))
+	for _, res := range responses {
+		m := zoneMetrics{Zone: res.MeshZone, Error: res.Error}
+		if m.Error == "" {
+			if err := json.Unmarshal([]byte(res.Msg), &m.ResMsgMetrics); err != nil {
+				m.Error = fmt.Sprintf("invalid metrics: %v", err)
+			}
+		}
+		metrics = append(metrics, m)
+	}
+	slices.SortFunc(metrics, func(a, b zoneMetrics) int { return cmp.Compare(a.Zone, b.Zone) })
+	return metrics
+}
+
+// printMetrics prints the metrics of the zones between since and until as
+// output, one of outputTable, outputChart or outputJSON.
+func printMetrics(w io.Writer, output string, since, until time.Time, metrics []zoneMetrics) {
+	switch output {
+	case outputJSON:
+		buf, _ := json.MarshalIndent(struct {
+			Since time.Time     `json:"since"`
+			Until time.Time     `json:"until"`
+			Zones []zoneMetrics `json:"zones"`
+		}{since, until, metrics}, "", "  ")
+		fmt.Fprintf(w, "%s\n", buf)
+	case outputChart:
+		printMetricsCharts(w, metrics)
+	default:
+		printMetricsTable(w, metrics)
+	}
+}
+
+// printMetricsTable prints a row per zone, followed by the errors of the
+// zones.
+func printMetricsTable(w io.Writer, metrics []zoneMetrics) {
+	var failures []string
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ZONE\tINVOCATIONS\tERRORS\tP50\tP95\tP99\tMEMORY\tCPU")
+	for _, m := range metrics {
+		if m.Error != "" {
+			failures = append(failures, fmt.Sprintf("[%s] Error: %s", m.Zone, m.Error))
+			continue
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%s\t%s\t%s\t%s\t%s\t%.1f%%\n",
+			m.Zone, m.Invocations, formatErrors(m.Errors, m.Invocations),
+			formatLatency(m.LatencyP50), formatLatency(m.LatencyP95), formatLatency(m.LatencyP99),
+			formatSize(int64(m.Memory)), m.CPU)
+	}
+	tw.Flush()
+
+	for _, e := range failures {
+		fmt.Fprintln(w, e)
+	}
+}
+
+// printMetricsCharts prints the series of each zone as sparklines, with the
+// total or average over the window.
+func printMetricsCharts(w io.Writer, metrics []zoneMetrics) {
+	for i, m := range metrics {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		if m.Error != "" {
+			fmt.Fprintf(w, "[%s] Error: %s\n", m.Zone, m.Error)
+			continue
+		}
+		fmt.Fprintln(w, m.Zone)
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		chart := func(name string, value func(b MetricsBucket) float64, summary string) {
+			values := make([]float64, len(m.Series))
+			for i, b := range m.Series {
+				values[i] = value(b)
+			}
+			fmt.Fprintf(tw, "  %s\t%s\t%s\n", name, sparkline(values), summary)
+		}
+		chart("invocations", func(b MetricsBucket) float64 { return float64(b.Invocations) }, fmt.Sprintf("%d", m.Invocations))
+		chart("errors", func(b MetricsBucket) float64 { return float64(b.Errors) }, formatErrors(m.Errors, m.Invocations))
+		chart("p95", func(b MetricsBucket) float64 { return b.LatencyP95 }, formatLatency(m.LatencyP95))
+		chart("memory", func(b MetricsBucket) float64 { return float64(b.Memory) }, formatSize(int64(m.Memory)))
+		chart("cpu", func(b MetricsBucket) float64 { return b.CPU }, fmt.Sprintf("%.1f%%", m.CPU))
+		tw.Flush()
+	}
+}
+
+// sparkline returns a bar per value, scaled between zero and the highest
+// value.
+func sparkline(values []float64) string {
+	if len(values) == 0 {
+		return "-"
+	}
+	highest := slices.Max(values)
+	var b strings.Builder
+	for _, v := range values {
+		i := 0
+		if highest > 0 && v > 0 {
+			i = min(int(v/highest*float64(len(sparks)-1)+0.5), len(sparks)-1)
+		}
+		b.WriteRune(sparks[i])
+	}
+	return b.String()
+}
+
+// formatErrors formats an error count with its rate of the invocations.
+func formatErrors(errors, invocations uint64) string {
+	if invocations == 0 {
+		return fmt.Sprintf("%d", errors)
+	}
+	return fmt.Sprintf("%d (%.1f%%)", errors, float64(errors)/float64(invocations)*100)
+}
+
+// formatLatency formats a latency in milliseconds.
+func formatLatency(ms float64) string {
+	return time.Duration(ms * float64(time.Millisecond)).Round(time.Millisecond / 10).String()
+}
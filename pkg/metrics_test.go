@@ -0,0 +1,45 @@
+package pkg
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestSparkline(t *testing.T) {
+	tests := []struct {
+		values   []float64
+		expected string
+	}{
+		{nil, "-"},
+		{[]float64{0, 0}, "▁▁"},
+		{[]float64{0, 1, 2, 3, 4, 5, 6, 7}, "▁▂▃▄▅▆▇█"},
+		{[]float64{5, 10}, "▅█"},
+	}
+	for _, tt := range tests {
+		if got := sparkline(tt.values); got != tt.expected {
+			t.Errorf("sparkline(%v) = %q, want %q", tt.values, got, tt.expected)
+		}
+	}
+}
+
+func TestParseMetrics(t *testing.T) {
+	metrics := parseMetrics([]Response{
+		{MeshZone: "zone-c", Msg: "not json"},
+		{MeshZone: "zone-b", Error: "tool not deployed"},
+		{MeshZone: "zone-a", Msg: `{"invocations":200,"errors":3,"latency_p50_ms":12.34,"latency_p95_ms":48,"latency_p99_ms":1500,"memory_bytes":67108864,"cpu_percent":12.5}`},
+	})
+
+	var out bytes.Buffer
+	printMetricsTable(&out, metrics)
+	expected := strings.Join([]string{
+		"ZONE    INVOCATIONS  ERRORS    P50     P95   P99   MEMORY    CPU",
+		"zone-a  200          3 (1.5%)  12.3ms  48ms  1.5s  64.0 MiB  12.5%",
+		"[zone-b] Error: tool not deployed",
+		"[zone-c] Error: invalid metrics: invalid character 'o' in literal null (expecting 'u')",
+		"",
+	}, "\n")
+	if out.String() != expected {
+		t.Errorf("Metrics table =\n%s\nwant\n%s", out.String(), expected)
+	}
+}
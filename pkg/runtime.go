@@ -0,0 +1,261 @@
+package pkg
+
+import (
+	"archive/zip"
+	"bytes"
+	"cmp"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+)
+
+// Runtime is the language runtime the uploaded source code is built for.
+type Runtime string
+
+const (
+	RuntimeGo     Runtime = "go"
+	RuntimeNode   Runtime = "node"
+	RuntimePython Runtime = "python"
+)
+
+// runtimeSpec describes how the source code of a runtime is recognized and
+// packaged.
+type runtimeSpec struct {
+	runtime Runtime
+	// exts are the extensions of source files which can be uploaded alone
+	exts []string
+	// markers are the files marking the project root
+	markers []string
+	// projectFiles are the files of the project root included with single
+	// file uploads
+	projectFiles []string
+	// ignores are the default ignore patterns for this runtime
+	ignores []string
+}
+
+var runtimeSpecs = []runtimeSpec{
+	{
+		runtime:      RuntimeGo,
+		exts:         []string{".go"},
+		markers:      []string{"go.mod"},
+		projectFiles: []string{"go.mod", "go.sum"},
+	},
+	{
+		runtime:      RuntimeNode,
+		exts:         []string{".ts"},
+		markers:      []string{"package.json"},
+		projectFiles: []string{"package.json", "package-lock.json", "yarn.lock", "pnpm-lock.yaml", "tsconfig.json"},
+		ignores: []string{
+			"node_modules/", // npm dependencies
+		},
+	},
+	{
+		runtime:      RuntimePython,
+		exts:         []string{".py"},
+		markers:      []string{"pyproject.toml", "requirements.txt"},
+		projectFiles: []string{"pyproject.toml", "requirements.txt", "poetry.lock", "uv.lock"},
+		ignores: []string{
+			"__pycache__/", // Python bytecode cache
+			"*.pyc",        // Python bytecode
+			".venv/",       // Python virtual environment
+		},
+	},
+}
+
+// specForRuntime returns the spec of runtime r, or nil if it is unknown.
+func specForRuntime(r Runtime) *runtimeSpec {
+	for i := range runtimeSpecs {
+		if runtimeSpecs[i].runtime == r {
+			return &runtimeSpecs[i]
+		}
+	}
+	return nil
+}
+
+// specForExt returns the spec of the runtime whose single source files have
+// extension ext, or nil if there is none.
+func specForExt(ext string) *runtimeSpec {
+	for i := range runtimeSpecs {
+		for _, e := range runtimeSpecs[i].exts {
+			if e == ext {
+				return &runtimeSpecs[i]
+			}
+		}
+	}
+	return nil
+}
+
+// DetectRuntime detects the runtime of the project in dir from its marker
+// files (go.mod, package.json, pyproject.toml or requirements.txt), falling
+// back to the extensions of the files in dir. Go is assumed when nothing
+// matches.
+func DetectRuntime(dir string) Runtime {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return RuntimeGo
+	}
+	names := make([]string, 0, len(entries))
+	for _, e := range entries {
+		if !e.IsDir() {
+			names = append(names, e.Name())
+		}
+	}
+	return detectRuntimeFromNames(names)
+}
+
+// DetectZipRuntime detects the runtime of a zip archive from the files at its
+// root, the same way DetectRuntime does for a directory.
+func DetectZipRuntime(data []byte) Runtime {
+	r, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return RuntimeGo
+	}
+	var names []string
+	for _, f := range r.File {
+		if dir, name := path.Split(f.Name); dir == "" {
+			names = append(names, name)
+		}
+	}
+	return detectRuntimeFromNames(names)
+}
+
+func detectRuntimeFromNames(names []string) Runtime {
+	set := make(map[string]bool, len(names))
+	for _, name := range names {
+		set[name] = true
+	}
+	for _, spec := range runtimeSpecs {
+		for _, marker := range spec.markers {
+			if set[marker] {
+				return spec.runtime
+			}
+		}
+	}
+	for _, spec := range runtimeSpecs {
+		for _, name := range names {
+			if s := specForExt(path.Ext(name)); s != nil && s.runtime == spec.runtime {
+				return spec.runtime
+			}
+		}
+	}
+	return RuntimeGo
+}
+
+// ZipSourceFiles creates a zip file from one or more source files of the same
+// runtime living in the same directory, as determined by their extension.
+// Go files are handled by ZipGoFiles.
+//
+// A single file outside of any project is stored as app.ts or app.py.
+// Otherwise the files keep their base names and the project files found in
+// the enclosing project root (package.json, tsconfig.json, lock files,
+// pyproject.toml, requirements.txt) are added next to them.
+func ZipSourceFiles(files []string, dst string, opts ...ZipOption) error {
+	if len(files) == 0 {
+		return errors.New("no source files specified")
+	}
+	ext := filepath.Ext(files[0])
+	spec := specForExt(ext)
+	if spec == nil {
+		return errors.New("unsupported src file type")
+	}
+	if spec.runtime == RuntimeGo {
+		return ZipGoFiles(files, dst, opts...)
+	}
+
+	options := newZipOptions(opts)
+
+	dir, err := sourceDir(files, ext)
+	if err != nil {
+		return err
+	}
+
+	entries := make(map[string]string) // name in archive -> path on disk
+
+	root := findProjectRoot(dir, spec.markers)
+	if root == "" && len(files) == 1 {
+		entries["app"+ext] = files[0]
+	} else {
+		for _, file := range files {
+			entries[filepath.Base(file)] = file
+		}
+	}
+
+	if root != "" {
+		log.Printf("Found %s project at %s, packaging project files", spec.runtime, root)
+		for _, name := range spec.projectFiles {
+			p := filepath.Join(root, name)
+			if _, err := os.Stat(p); err == nil {
+				entries[name] = p
+			}
+		}
+	}
+
+	links, err := newLinkWalker(cmp.Or(root, dir), options)
+	if err != nil {
+		return err
+	}
+
+	zipFile, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer zipFile.Close()
+
+	archive := newArchiveWriter(zipFile, options)
+	if err := links.addEntries(archive, entries); err != nil {
+		return err
+	}
+	return archive.Close()
+}
+
+// sourceDir returns the directory shared by all files, all of them must have
+// extension ext and live in the same directory.
+func sourceDir(files []string, ext string) (string, error) {
+	var dir string
+	for i, file := range files {
+		if filepath.Ext(file) != ext {
+			return "", fmt.Errorf("%s is not a %s file", file, ext)
+		}
+		abs, err := filepath.Abs(file)
+		if err != nil {
+			return "", err
+		}
+		if i == 0 {
+			dir = filepath.Dir(abs)
+		} else if filepath.Dir(abs) != dir {
+			return "", fmt.Errorf("all %s files must be in the same directory", ext)
+		}
+	}
+	return dir, nil
+}
+
+// projectBoundaries end the search of findProjectRoot, a project doesn't span
+// several repositories or yc.yml configurations.
+var projectBoundaries = []string{".git", ".hg", ".svn", "yc.yml"}
+
+// findProjectRoot walks up from dir and returns the first directory containing
+// one of the marker files, or an empty string if there is none. The walk stops
+// at the root of the repository or the directory of yc.yml, whichever is
+// nearer.
+func findProjectRoot(dir string, markers []string) string {
+	for {
+		for _, marker := range markers {
+			if fi, err := os.Stat(filepath.Join(dir, marker)); err == nil && !fi.IsDir() {
+				return dir
+			}
+		}
+		for _, boundary := range projectBoundaries {
+			if _, err := os.Stat(filepath.Join(dir, boundary)); err == nil {
+				return ""
+			}
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
@@ -0,0 +1,168 @@
+package pkg
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDetectRuntime(t *testing.T) {
+	tests := []struct {
+		name  string
+		files []string
+		want  Runtime
+	}{
+		{"go module", []string{"go.mod", "app.go"}, RuntimeGo},
+		{"node project", []string{"package.json", "index.ts"}, RuntimeNode},
+		{"python project", []string{"pyproject.toml", "app.py"}, RuntimePython},
+		{"python requirements", []string{"requirements.txt"}, RuntimePython},
+		{"typescript file", []string{"index.ts", "README.md"}, RuntimeNode},
+		{"python file", []string{"app.py"}, RuntimePython},
+		{"empty", nil, RuntimeGo},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for _, name := range tt.files {
+				if err := os.WriteFile(filepath.Join(dir, name), []byte(""), 0644); err != nil {
+					t.Fatalf("Failed to create file %s: %v", name, err)
+				}
+			}
+			if got := DetectRuntime(dir); got != tt.want {
+				t.Errorf("DetectRuntime() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFindProjectRoot(t *testing.T) {
+	tempDir := t.TempDir()
+
+	// a stray package.json above the repository is not part of the project
+	repo := filepath.Join(tempDir, "repo")
+	src := filepath.Join(repo, "tools", "weather")
+	for _, dir := range []string{filepath.Join(repo, ".git"), src} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatalf("Failed to create directory %s: %v", dir, err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(tempDir, "package.json"), []byte("{}"), 0644); err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+	if root := findProjectRoot(src, []string{"package.json"}); root != "" {
+		t.Errorf("findProjectRoot() = %s, want no root inside the repository", root)
+	}
+
+	if err := os.WriteFile(filepath.Join(repo, "package.json"), []byte("{}"), 0644); err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+	if root := findProjectRoot(src, []string{"package.json"}); root != repo {
+		t.Errorf("findProjectRoot() = %s, want the repository root %s", root, repo)
+	}
+
+	if err := os.WriteFile(filepath.Join(src, "yc.yml"), []byte(""), 0644); err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+	if root := findProjectRoot(src, []string{"package.json"}); root != "" {
+		t.Errorf("findProjectRoot() = %s, want the search to stop at yc.yml", root)
+	}
+}
+
+func TestZipSourceFiles(t *testing.T) {
+	tempDir := t.TempDir()
+
+	nodeProject := filepath.Join(tempDir, "node_project")
+	if err := os.MkdirAll(filepath.Join(nodeProject, "src"), 0755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+
+	testFiles := map[string]string{
+		filepath.Join(nodeProject, "package.json"):      `{"name": "tool"}`,
+		filepath.Join(nodeProject, "package-lock.json"): `{}`,
+		filepath.Join(nodeProject, "tsconfig.json"):     `{}`,
+		filepath.Join(nodeProject, "src", "index.ts"):   "export const a = 1",
+		filepath.Join(nodeProject, "src", "util.ts"):    "export const b = 2",
+		filepath.Join(tempDir, "single.py"):             "print('hi')",
+	}
+	for filePath, content := range testFiles {
+		if err := os.WriteFile(filePath, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to create file %s: %v", filePath, err)
+		}
+	}
+
+	zipPath := filepath.Join(tempDir, "node.zip")
+	err := ZipSourceFiles([]string{filepath.Join(nodeProject, "src", "index.ts"), filepath.Join(nodeProject, "src", "util.ts")}, zipPath)
+	if err != nil {
+		t.Fatalf("ZipSourceFiles failed: %v", err)
+	}
+	zipContents := readZipNames(t, zipPath)
+	for _, expectedFile := range []string{"index.ts", "util.ts", "package.json", "package-lock.json", "tsconfig.json"} {
+		if !zipContents[expectedFile] {
+			t.Errorf("Expected file %s is missing from zip", expectedFile)
+		}
+	}
+
+	zipPath = filepath.Join(tempDir, "python.zip")
+	if err := ZipSourceFiles([]string{filepath.Join(tempDir, "single.py")}, zipPath); err != nil {
+		t.Fatalf("ZipSourceFiles failed: %v", err)
+	}
+	zipContents = readZipNames(t, zipPath)
+	if len(zipContents) != 1 || !zipContents["app.py"] {
+		t.Errorf("Expected only app.py in zip, got %v", zipContents)
+	}
+
+	err = ZipSourceFiles([]string{filepath.Join(tempDir, "single.py"), filepath.Join(nodeProject, "src", "index.ts")}, zipPath)
+	if err == nil {
+		t.Error("Expected error when mixing source file types")
+	}
+
+	// The project files follow the symlink policy as well
+	tsconfig := filepath.Join(nodeProject, "tsconfig.json")
+	os.Remove(tsconfig)
+	if err := os.Symlink(filepath.Join(tempDir, "single.py"), tsconfig); err != nil {
+		t.Skipf("Symlinks not supported: %v", err)
+	}
+	err = ZipSourceFiles([]string{filepath.Join(nodeProject, "src", "index.ts")}, zipPath)
+	if err == nil || !strings.Contains(err.Error(), "outside the source tree") {
+		t.Errorf("Expected error when a project file links outside the project, got %v", err)
+	}
+}
+
+func TestZipWithExclusionsRuntimeIgnores(t *testing.T) {
+	tempDir := t.TempDir()
+
+	testProject := filepath.Join(tempDir, "python_project")
+	for _, dir := range []string{
+		filepath.Join(testProject, "__pycache__"),
+		filepath.Join(testProject, ".venv", "lib"),
+	} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatalf("Failed to create directory %s: %v", dir, err)
+		}
+	}
+
+	testFiles := map[string]string{
+		filepath.Join(testProject, "pyproject.toml"):          "[project]\nname = \"tool\"\n",
+		filepath.Join(testProject, "app.py"):                  "print('hi')",
+		filepath.Join(testProject, "util.pyc"):                "bytecode",
+		filepath.Join(testProject, "__pycache__", "app.pyc"):  "bytecode",
+		filepath.Join(testProject, ".venv", "lib", "site.py"): "site",
+	}
+	for filePath, content := range testFiles {
+		if err := os.WriteFile(filePath, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to create file %s: %v", filePath, err)
+		}
+	}
+
+	zipPath := filepath.Join(tempDir, "python.zip")
+	if err := ZipWithExclusions(testProject, zipPath); err != nil {
+		t.Fatalf("ZipWithExclusions failed: %v", err)
+	}
+
+	zipContents := readZipNames(t, zipPath)
+	if len(zipContents) != 2 || !zipContents["app.py"] || !zipContents["pyproject.toml"] {
+		t.Errorf("Expected only app.py and pyproject.toml in zip, got %v", zipContents)
+	}
+}
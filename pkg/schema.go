@@ -0,0 +1,297 @@
+package pkg
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Schema is the subset of JSON Schema used by tool input schemas, as
+// generated from the InputSchema of a tool.
+type Schema struct {
+	Type        string             `json:"type,omitempty"`
+	Description string             `json:"description,omitempty"`
+	Properties  map[string]*Schema `json:"properties,omitempty"`
+	Required    []string           `json:"required,omitempty"`
+	Items       *Schema            `json:"items,omitempty"`
+	Enum        []any              `json:"enum,omitempty"`
+}
+
+// ParseSchema decodes a JSON input schema, it returns nil for an empty or
+// null schema.
+func ParseSchema(data []byte) (*Schema, error) {
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 || string(data) == "null" {
+		return nil, nil
+	}
+	var s Schema
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("invalid input schema: %w", err)
+	}
+	return &s, nil
+}
+
+// Validate checks the JSON document data against the schema.
+func (s *Schema) Validate(data []byte) error {
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.UseNumber()
+	var v any
+	if err := d.Decode(&v); err != nil {
+		return fmt.Errorf("invalid JSON: %w", err)
+	}
+	return s.validate("", v)
+}
+
+// validate checks v, decoded with json.Number numbers, against the schema.
+// path locates v in the document for error messages.
+func (s *Schema) validate(path string, v any) error {
+	if len(s.Enum) > 0 && !s.inEnum(v) {
+		return fmt.Errorf("%s must be one of %s", describePath(path), s.enumString())
+	}
+
+	switch s.Type {
+	case "object":
+		m, ok := v.(map[string]any)
+		if !ok {
+			return typeError(path, s.Type, v)
+		}
+		for _, name := range s.Required {
+			if _, ok := m[name]; !ok {
+				return fmt.Errorf("%s is required", describePath(joinPath(path, name)))
+			}
+		}
+		for name, pv := range m {
+			if ps := s.Properties[name]; ps != nil {
+				if err := ps.validate(joinPath(path, name), pv); err != nil {
+					return err
+				}
+			}
+		}
+	case "array":
+		a, ok := v.([]any)
+		if !ok {
+			return typeError(path, s.Type, v)
+		}
+		if s.Items != nil {
+			for i, item := range a {
+				if err := s.Items.validate(fmt.Sprintf("%s[%d]", path, i), item); err != nil {
+					return err
+				}
+			}
+		}
+	case "string":
+		if _, ok := v.(string); !ok {
+			return typeError(path, s.Type, v)
+		}
+	case "integer":
+		n, ok := v.(json.Number)
+		if !ok {
+			return typeError(path, s.Type, v)
+		}
+		if _, err := n.Int64(); err != nil {
+			return typeError(path, s.Type, v)
+		}
+	case "number":
+		if _, ok := v.(json.Number); !ok {
+			return typeError(path, s.Type, v)
+		}
+	case "boolean":
+		if _, ok := v.(bool); !ok {
+			return typeError(path, s.Type, v)
+		}
+	case "null":
+		if v != nil {
+			return typeError(path, s.Type, v)
+		}
+	}
+	return nil
+}
+
+func (s *Schema) inEnum(v any) bool {
+	got, _ := json.Marshal(v)
+	for _, e := range s.Enum {
+		if want, _ := json.Marshal(e); bytes.Equal(got, want) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Schema) enumString() string {
+	values := make([]string, len(s.Enum))
+	for i, e := range s.Enum {
+		b, _ := json.Marshal(e)
+		values[i] = string(b)
+	}
+	return strings.Join(values, ", ")
+}
+
+func joinPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+func describePath(path string) string {
+	if path == "" {
+		return "arguments"
+	}
+	return "argument " + path
+}
+
+func typeError(path, want string, v any) error {
+	return fmt.Errorf("%s must be %s, got %s", describePath(path), withArticle(want), jsonType(v))
+}
+
+func withArticle(typ string) string {
+	if strings.IndexByte("aeiou", typ[0]) >= 0 {
+		return "an " + typ
+	}
+	return "a " + typ
+}
+
+// jsonType returns the JSON type name of a decoded value.
+func jsonType(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case json.Number:
+		if _, err := v.Int64(); err == nil {
+			return "integer"
+		}
+		return "number"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case []any:
+		return "array"
+	default:
+		return "object"
+	}
+}
+
+// PromptArgs interactively asks for each property of an object schema,
+// required ones first, and returns the arguments as a JSON object. Optional
+// properties are skipped with an empty answer, invalid answers are asked
+// again.
+func PromptArgs(r io.Reader, w io.Writer, s *Schema) (json.RawMessage, error) {
+	names := make([]string, 0, len(s.Properties))
+	for name := range s.Properties {
+		names = append(names, name)
+	}
+	sort.SliceStable(names, func(i, j int) bool {
+		ri, rj := slices.Contains(s.Required, names[i]), slices.Contains(s.Required, names[j])
+		if ri != rj {
+			return ri
+		}
+		return names[i] < names[j]
+	})
+
+	br := bufio.NewReader(r)
+	args := make(map[string]any, len(names))
+	for _, name := range names {
+		ps := s.Properties[name]
+		required := slices.Contains(s.Required, name)
+		for {
+			fmt.Fprint(w, promptLabel(name, ps, required))
+			line, err := br.ReadString('\n')
+			if err != nil && err != io.EOF {
+				return nil, err
+			}
+			line = strings.TrimSpace(line)
+			if line == "" {
+				if !required {
+					break
+				}
+				if err == io.EOF {
+					return nil, fmt.Errorf("missing required argument %s", name)
+				}
+				fmt.Fprintln(w, "  this argument is required")
+				continue
+			}
+
+			v, err := parseArg(ps, line)
+			if err == nil {
+				err = ps.validate(name, v)
+			}
+			if err != nil {
+				fmt.Fprintln(w, " ", err)
+				continue
+			}
+			args[name] = v
+			break
+		}
+	}
+	return json.Marshal(args)
+}
+
+// promptLabel formats the question asked for a property, e.g.
+// "city (string, required) - the city name: ".
+func promptLabel(name string, s *Schema, required bool) string {
+	var details []string
+	if s.Type != "" {
+		details = append(details, s.Type)
+	}
+	if len(s.Enum) > 0 {
+		details = append(details, "one of "+s.enumString())
+	}
+	if required {
+		details = append(details, "required")
+	}
+
+	label := name
+	if len(details) > 0 {
+		label += " (" + strings.Join(details, ", ") + ")"
+	}
+	if s.Description != "" {
+		label += " - " + s.Description
+	}
+	return label + ": "
+}
+
+// parseArg parses an answer according to the property type. Strings are
+// taken as typed, other types are parsed as JSON.
+func parseArg(s *Schema, input string) (any, error) {
+	switch s.Type {
+	case "string":
+		return input, nil
+	case "integer":
+		if _, err := strconv.ParseInt(input, 10, 64); err != nil {
+			return nil, fmt.Errorf("%q is not an integer", input)
+		}
+		return json.Number(input), nil
+	case "number":
+		if _, err := strconv.ParseFloat(input, 64); err != nil {
+			return nil, fmt.Errorf("%q is not a number", input)
+		}
+		return json.Number(input), nil
+	case "boolean":
+		b, err := strconv.ParseBool(input)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not a boolean, use true or false", input)
+		}
+		return b, nil
+	}
+
+	d := json.NewDecoder(strings.NewReader(input))
+	d.UseNumber()
+	var v any
+	if err := d.Decode(&v); err != nil {
+		if s.Type == "" {
+			// untyped properties accept plain strings
+			return input, nil
+		}
+		return nil, fmt.Errorf("invalid JSON %s: %v", s.Type, err)
+	}
+	return v, nil
+}
@@ -0,0 +1,117 @@
+package pkg
+
+import (
+	"strings"
+	"testing"
+)
+
+const testSchema = `{
+	"type": "object",
+	"properties": {
+		"city": {"type": "string", "description": "the city name"},
+		"days": {"type": "integer"},
+		"unit": {"type": "string", "enum": ["celsius", "fahrenheit"]},
+		"tags": {"type": "array", "items": {"type": "string"}},
+		"detailed": {"type": "boolean"}
+	},
+	"required": ["city"]
+}`
+
+func TestSchemaValidate(t *testing.T) {
+	schema, err := ParseSchema([]byte(testSchema))
+	if err != nil {
+		t.Fatalf("ParseSchema failed: %v", err)
+	}
+
+	tests := []struct {
+		args     string
+		expected string
+	}{
+		{`{"city": "Paris"}`, ""},
+		{`{"city": "Paris", "days": 3, "unit": "celsius", "tags": ["a"], "detailed": true, "extra": 1}`, ""},
+		{`{}`, "argument city is required"},
+		{`{"city": 1}`, "argument city must be a string, got integer"},
+		{`{"city": "Paris", "days": 1.5}`, "argument days must be an integer, got number"},
+		{`{"city": "Paris", "unit": "kelvin"}`, `argument unit must be one of "celsius", "fahrenheit"`},
+		{`{"city": "Paris", "tags": ["a", 2]}`, "argument tags[1] must be a string, got integer"},
+		{`[]`, "arguments must be an object, got array"},
+		{`{`, "invalid JSON"},
+	}
+
+	for _, tt := range tests {
+		err := schema.Validate([]byte(tt.args))
+		if tt.expected == "" {
+			if err != nil {
+				t.Errorf("Validate(%s) failed: %v", tt.args, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.expected) {
+			t.Errorf("Validate(%s) = %v, want error containing %q", tt.args, err, tt.expected)
+		}
+	}
+}
+
+func TestParseSchemaEmpty(t *testing.T) {
+	for _, data := range []string{"", "null", " "} {
+		schema, err := ParseSchema([]byte(data))
+		if err != nil || schema != nil {
+			t.Errorf("ParseSchema(%q) = %v, %v, want nil, nil", data, schema, err)
+		}
+	}
+}
+
+func TestPromptArgs(t *testing.T) {
+	schema, err := ParseSchema([]byte(testSchema))
+	if err != nil {
+		t.Fatalf("ParseSchema failed: %v", err)
+	}
+
+	// city is asked first as it is required, then the optional properties in
+	// alphabetical order: days, detailed, tags, unit
+	input := strings.Join([]string{
+		"",       // city is required
+		"Paris",  // city
+		"three",  // days, not an integer
+		"3",      // days
+		"",       // detailed, skipped
+		`["a"]`,  // tags
+		"kelvin", // unit, not in the enum
+		"celsius",
+	}, "\n") + "\n"
+
+	var out strings.Builder
+	args, err := PromptArgs(strings.NewReader(input), &out, schema)
+	if err != nil {
+		t.Fatalf("PromptArgs failed: %v", err)
+	}
+
+	expected := `{"city":"Paris","days":3,"tags":["a"],"unit":"celsius"}`
+	if string(args) != expected {
+		t.Errorf("PromptArgs() = %s, want %s", args, expected)
+	}
+
+	for _, s := range []string{
+		"city (string, required) - the city name: ",
+		"this argument is required",
+		`"three" is not an integer`,
+		`unit (string, one of "celsius", "fahrenheit"): `,
+		`argument unit must be one of "celsius", "fahrenheit"`,
+	} {
+		if !strings.Contains(out.String(), s) {
+			t.Errorf("Prompt output %q does not contain %q", out.String(), s)
+		}
+	}
+}
+
+func TestPromptArgsMissingRequired(t *testing.T) {
+	schema, err := ParseSchema([]byte(testSchema))
+	if err != nil {
+		t.Fatalf("ParseSchema failed: %v", err)
+	}
+
+	var out strings.Builder
+	if _, err := PromptArgs(strings.NewReader(""), &out, schema); err == nil {
+		t.Error("Expected error when input ends before required arguments")
+	}
+}
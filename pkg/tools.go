@@ -0,0 +1,284 @@
+package pkg
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"sync"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// maxResultMessage bounds the message shown in the result table.
+const maxResultMessage = 60
+
+// ToolConfig declares a tool of the project in the tools list of yc.yml.
+type ToolConfig struct {
+	Name string   `mapstructure:"name"`
+	Src  string   `mapstructure:"src"`
+	Envs []string `mapstructure:"envs"`
+}
+
+// validateTools checks the tools declared in yc.yml.
+func validateTools(tools []ToolConfig) error {
+	seen := make(map[string]bool, len(tools))
+	for i, t := range tools {
+		if t.Name == "" {
+			return fmt.Errorf("tools[%d]: missing name", i)
+		}
+		if strings.Contains(t.Name, ",") {
+			return fmt.Errorf("tools[%d]: name %q contains a comma", i, t.Name)
+		}
+		if seen[t.Name] {
+			return fmt.Errorf("tools[%d]: duplicate name %q", i, t.Name)
+		}
+		seen[t.Name] = true
+	}
+	return nil
+}
+
+// selectTools returns the tools selected by --all or a comma separated
+// --tool, and whether more than one tool may be selected. Tools missing from
+// yc.yml are returned with only their name.
+func (c *command) selectTools(all bool) ([]ToolConfig, bool, error) {
+	if all {
+		if len(c.tools) == 0 {
+			return nil, true, errors.New("--all needs the tools list in yc.yml")
+		}
+		return c.tools, true, nil
+	}
+
+	var selected []ToolConfig
+	names := strings.Split(c.tool, ",")
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			return nil, false, fmt.Errorf("invalid --tool %q", c.tool)
+		}
+		i := slices.IndexFunc(c.tools, func(t ToolConfig) bool { return t.Name == name })
+		if i < 0 {
+			selected = append(selected, ToolConfig{Name: name})
+		} else {
+			selected = append(selected, c.tools[i])
+		}
+	}
+	return selected, len(names) > 1, nil
+}
+
+// forTool returns a command acting on tool, with its own target and response
+// state so that tools can be run concurrently. Its output is prefixed with
+// the tool name.
+func (c *command) forTool(tool string, out io.Writer) *command {
+	tc := &command{
+		tid:         c.tid + "-" + tool,
+		zipperAddr:  c.zipperAddr,
+		secret:      c.secret,
+		tool:        tool,
+		meshNum:     c.meshNum,
+		zones:       c.zones,
+		mesh:        c.mesh,
+		meshSet:     c.meshSet,
+		out:         out,
+		vendor:      c.vendor,
+		maxSize:     c.maxSize,
+		maxFileSize: c.maxFileSize,
+		explain:     c.explain,
+		symlinks:    c.symlinks,
+		timeout:     c.timeout,
+		specVersion: c.specVersion,
+		hello:       c.hello,
+		helloErr:    c.helloErr,
+		releaseURL:  c.releaseURL,
+		encoding:    c.encoding,
+		codec:       c.codec,
+		logger:      c.logger.With("tool", tool),
+	}
+	tc.spanCtx.Store(c.spanCtx.Load())
+	return tc
+}
+
+// forEachTool returns the Run function of a command supporting --tool a,b
+// and --all. A single tool is run by single as before, several tools are
+// run concurrently by each, and their results are printed as a table.
+func (c *command) forEachTool(all *bool, single func(cmd *cobra.Command, args []string), each func(tc *command, t ToolConfig) error) func(cmd *cobra.Command, args []string) {
+	return func(cmd *cobra.Command, args []string) {
+		tools, multi, err := c.selectTools(*all)
+		if err != nil {
+			fmt.Fprintln(c.out, "Error:", err)
+			c.exit(1)
+		}
+		if !multi {
+			single(cmd, args)
+			return
+		}
+		if len(args) > 0 {
+			fmt.Fprintln(c.out, "Error: arguments can't be used with several tools, set their src in yc.yml")
+			c.exit(1)
+		}
+
+		// the handshake is shared by every tool
+		if err := c.negotiate(); err != nil {
+			fmt.Fprintln(c.out, "Error:", err)
+			c.exit(1)
+		}
+
+		results := &toolResults{}
+		out := &lockedWriter{w: c.out}
+		var wg sync.WaitGroup
+		for _, t := range tools {
+			tc := c.forTool(t.Name, &prefixWriter{w: out, prefix: t.Name + ": "})
+			tc.onResponse = func(res *Response) { results.add(t.Name, res.MeshZone, res) }
+			wg.Go(func() {
+				ctx, span := tc.startSpan("tool "+t.Name, trace.WithAttributes(attribute.String("yc.tool", t.Name)))
+				tc.spanCtx.Store(&ctx)
+				err := each(tc, t)
+				endSpan(span, err)
+				switch {
+				case tc.lastError() != "":
+					// reported by the zones, and already in results
+				case err != nil:
+					fmt.Fprintln(tc.out, "Error:", err)
+					results.add(t.Name, "-", &Response{Error: err.Error()})
+				case !tc.allResponded():
+					results.add(t.Name, "-", &Response{Error: fmt.Sprintf("%d of %d zones responded", tc.resCount.Load(), tc.expectedResponses())})
+				}
+			})
+		}
+		wg.Wait()
+
+		fmt.Fprintln(c.out)
+		if failures := results.print(c.out, tools); failures > 0 {
+			c.exit(1)
+		}
+	}
+}
+
+// sendTool sends a request for a tool, and returns the error of the zones.
+func sendTool[T any](tc *command, tag uint32, reqMsg *T) error {
+	if err := send(tc, tag, reqMsg, nil, nil); err != nil {
+		return err
+	}
+	if errMsg := tc.lastError(); errMsg != "" {
+		return errors.New(errMsg)
+	}
+	return nil
+}
+
+// deployTool packages the source of t, uploads it, then replaces the running
+// deployment with the envs of t and --env.
+func (c *command) deployTool(tc *command, t ToolConfig) error {
+	if t.Src == "" {
+		return fmt.Errorf("tool %s has no src in yc.yml", t.Name)
+	}
+	opts, err := c.zipOptions()
+	if err != nil {
+		return err
+	}
+	data, runtime, err := tc.pack([]string{t.Src}, opts...)
+	if err != nil {
+		return err
+	}
+
+	if err := sendTool(tc, TAG_REQUEST_UPLOAD, &ReqMsgUpload{ZipData: data, Runtime: runtime}); err != nil {
+		return err
+	}
+	if err := sendTool(tc, TAG_REQUEST_REMOVE, &ReqMsgRemove{}); err != nil {
+		return err
+	}
+	envs := append(slices.Clone(t.Envs), c.envs...)
+	return sendTool(tc, TAG_REQUEST_CREATE, &ReqMsgCreate{Envs: &envs})
+}
+
+// toolResults collects the last response of each zone for each tool.
+type toolResults struct {
+	mu    sync.Mutex
+	zones map[string][]string
+	last  map[[2]string]*Response
+}
+
+func (r *toolResults) add(tool, zone string, res *Response) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.zones == nil {
+		r.zones = make(map[string][]string)
+		r.last = make(map[[2]string]*Response)
+	}
+	key := [2]string{tool, zone}
+	if _, ok := r.last[key]; !ok {
+		r.zones[tool] = append(r.zones[tool], zone)
+	}
+	r.last[key] = res
+}
+
+// print prints a row per tool and zone in the order of tools, and returns
+// the number of failed rows.
+func (r *toolResults) print(w io.Writer, tools []ToolConfig) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	failures := 0
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "TOOL\tZONE\tSTATUS\tMESSAGE")
+	for _, t := range tools {
+		zones := slices.Clone(r.zones[t.Name])
+		slices.Sort(zones)
+		for _, zone := range zones {
+			res := r.last[[2]string{t.Name, zone}]
+			status, msg := "OK", res.Msg
+			if res.Error != "" {
+				status, msg = "FAILED", res.Error
+				failures++
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", t.Name, zone, status, summarize(msg))
+		}
+	}
+	tw.Flush()
+	return failures
+}
+
+// summarize returns the first line of msg, shortened for the result table.
+func summarize(msg string) string {
+	msg, _, _ = strings.Cut(strings.TrimSpace(msg), "\n")
+	if len(msg) > maxResultMessage {
+		msg = msg[:maxResultMessage-3] + "..."
+	}
+	return msg
+}
+
+// lockedWriter serializes the writes of concurrent tools.
+type lockedWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (l *lockedWriter) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.w.Write(p)
+}
+
+// prefixWriter prefixes every line with the tool name. The lines are
+// expected to be written whole, as fmt.Fprintln does.
+type prefixWriter struct {
+	w      io.Writer
+	prefix string
+}
+
+func (p *prefixWriter) Write(b []byte) (int, error) {
+	lines := strings.SplitAfter(string(b), "\n")
+	var buf strings.Builder
+	for _, line := range lines {
+		if line != "" {
+			buf.WriteString(p.prefix + line)
+		}
+	}
+	if _, err := io.WriteString(p.w, buf.String()); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
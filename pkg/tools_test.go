@@ -0,0 +1,87 @@
+package pkg
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestSelectTools(t *testing.T) {
+	c := &command{tools: []ToolConfig{{Name: "a", Src: "./a"}, {Name: "b", Src: "./b"}}}
+
+	tests := []struct {
+		tool     string
+		all      bool
+		expected []ToolConfig
+		multi    bool
+	}{
+		{"a", false, []ToolConfig{{Name: "a", Src: "./a"}}, false},
+		{"x", false, []ToolConfig{{Name: "x"}}, false},
+		{"b, x", false, []ToolConfig{{Name: "b", Src: "./b"}, {Name: "x"}}, true},
+		{"x", true, c.tools, true},
+	}
+
+	for _, tt := range tests {
+		c.tool = tt.tool
+		tools, multi, err := c.selectTools(tt.all)
+		if err != nil {
+			t.Fatalf("selectTools(%q, %v) failed: %v", tt.tool, tt.all, err)
+		}
+		if multi != tt.multi || len(tools) != len(tt.expected) {
+			t.Fatalf("selectTools(%q, %v) = %v, %v, want %v, %v", tt.tool, tt.all, tools, multi, tt.expected, tt.multi)
+		}
+		for i := range tools {
+			if tools[i].Name != tt.expected[i].Name || tools[i].Src != tt.expected[i].Src {
+				t.Errorf("selectTools(%q, %v) = %v, want %v", tt.tool, tt.all, tools, tt.expected)
+			}
+		}
+	}
+
+	c.tool = "a,"
+	if _, _, err := c.selectTools(false); err == nil {
+		t.Error("Expected error for an empty tool name")
+	}
+	if _, _, err := (&command{}).selectTools(true); err == nil {
+		t.Error("Expected error for --all without tools")
+	}
+}
+
+func TestValidateTools(t *testing.T) {
+	for _, tools := range [][]ToolConfig{
+		{{Name: ""}},
+		{{Name: "a,b"}},
+		{{Name: "a"}, {Name: "a"}},
+	} {
+		if err := validateTools(tools); err == nil {
+			t.Errorf("Expected error for tools %v", tools)
+		}
+	}
+	if err := validateTools([]ToolConfig{{Name: "a"}, {Name: "b"}}); err != nil {
+		t.Errorf("validateTools failed: %v", err)
+	}
+}
+
+func TestToolResults(t *testing.T) {
+	r := &toolResults{}
+	r.add("b", "zone-b", &Response{Msg: "uploaded"})
+	r.add("b", "zone-b", &Response{Msg: "created b\nmore"})
+	r.add("b", "zone-a", &Response{Error: "not deployed"})
+	r.add("a", "-", &Response{Error: "1 of 2 zones responded"})
+
+	var out bytes.Buffer
+	failures := r.print(&out, []ToolConfig{{Name: "a"}, {Name: "b"}})
+	if failures != 2 {
+		t.Errorf("Expected 2 failures, got %d", failures)
+	}
+
+	expected := strings.Join([]string{
+		"TOOL  ZONE    STATUS  MESSAGE",
+		"a     -       FAILED  1 of 2 zones responded",
+		"b     zone-a  FAILED  not deployed",
+		"b     zone-b  OK      created b",
+		"",
+	}, "\n")
+	if out.String() != expected {
+		t.Errorf("Result table =\n%s\nwant\n%s", out.String(), expected)
+	}
+}
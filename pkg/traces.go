@@ -0,0 +1,301 @@
+package pkg
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+const (
+	outputOTLP = "otlp"
+
+	// traceBarWidth is the width of the bars of the waterfall
+	traceBarWidth = 40
+)
+
+// zoneTrace is the trace of an invocation handled by Zone.
+type zoneTrace struct {
+	Zone string
+	InvocationTrace
+}
+
+// start returns the start of the first span of the trace.
+func (t zoneTrace) start() time.Time {
+	var start time.Time
+	for _, s := range t.Spans {
+		if start.IsZero() || s.Start.Before(start) {
+			start = s.Start
+		}
+	}
+	return start
+}
+
+// end returns the end of the last span of the trace.
+func (t zoneTrace) end() time.Time {
+	var end time.Time
+	for _, s := range t.Spans {
+		if s.End.After(end) {
+			end = s.End
+		}
+	}
+	return end
+}
+
+// parseTraces returns the traces of the zones, oldest first, and the errors
+// of the zones.
+func parseTraces(responses []Response) ([]zoneTrace, []string) {
+	var (
+		traces   []zoneTrace
+		failures []string
+	)
+	for _, res := range responses {
+		if res.Error != "" {
+			failures = append(failures, fmt.Sprintf("[%s] Error: %s", res.MeshZone, res.Error))
+			continue
+		}
+		var msg ResMsgTrace
+		if err := json.Unmarshal([]byte(res.Msg), &msg); err != nil {
+			failures = append(failures, fmt.Sprintf("[%s] Error: invalid traces: %v", res.MeshZone, err))
+			continue
+		}
+		for _, t := range msg.Traces {
+			if len(t.Spans) > 0 {
+				traces = append(traces, zoneTrace{Zone: res.MeshZone, InvocationTrace: t})
+			}
+		}
+	}
+	slices.SortFunc(traces, func(a, b zoneTrace) int {
+		return cmp.Or(a.start().Compare(b.start()), cmp.Compare(a.Zone, b.Zone))
+	})
+	slices.Sort(failures)
+	return traces, failures
+}
+
+// printTraces prints each trace as a waterfall of its spans, followed by
+// the time spent in each service.
+func printTraces(w io.Writer, traces []zoneTrace) {
+	if len(traces) == 0 {
+		fmt.Fprintln(w, "No traces found")
+		return
+	}
+	for i, t := range traces {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		printWaterfall(w, t)
+	}
+}
+
+func printWaterfall(w io.Writer, t zoneTrace) {
+	start, end := t.start(), t.end()
+	total := max(end.Sub(start), time.Nanosecond)
+	fmt.Fprintf(w, "%s in %s at %s (%s), trace %s\n", t.RequestID, t.Zone, start.Local().Format(logTimeFormat), formatSpanDuration(total), t.TraceID)
+
+	spans := slices.Clone(t.Spans)
+	slices.SortStableFunc(spans, func(a, b TraceSpan) int { return a.Start.Compare(b.Start) })
+
+	// the spans without a parent in the trace, or their own parent, are roots
+	ids := make(map[string]bool, len(spans))
+	for _, s := range spans {
+		if s.SpanID != "" {
+			ids[s.SpanID] = true
+		}
+	}
+	var roots []int
+	children := make(map[string][]int)
+	for i, s := range spans {
+		parent := s.ParentSpanID
+		if parent == "" || parent == s.SpanID || !ids[parent] {
+			roots = append(roots, i)
+			continue
+		}
+		children[parent] = append(children[parent], i)
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	visited := make([]bool, len(spans))
+	var walk func(indexes []int, depth int)
+	walk = func(indexes []int, depth int) {
+		for _, i := range indexes {
+			if visited[i] {
+				continue
+			}
+			visited[i] = true
+			s := spans[i]
+			line := fmt.Sprintf("  %s%s\t%s\t|%s|\t%s", strings.Repeat("  ", depth), s.Name, s.Service, traceBar(s, start, total), formatSpanDuration(s.End.Sub(s.Start)))
+			if s.Error != "" {
+				line += " error: " + s.Error
+			}
+			fmt.Fprintln(tw, line)
+			if s.SpanID != "" {
+				walk(children[s.SpanID], depth+1)
+			}
+		}
+	}
+	walk(roots, 0)
+	// the spans of a parent cycle are not reachable from a root
+	for i := range spans {
+		walk([]int{i}, 0)
+	}
+	tw.Flush()
+
+	var summary []string
+	for _, st := range serviceTimes(t.Spans) {
+		summary = append(summary, fmt.Sprintf("%s %s", st.service, formatSpanDuration(st.time)))
+	}
+	fmt.Fprintf(w, "  time by service: %s\n", strings.Join(summary, ", "))
+}
+
+// traceBar returns the bar of s, placed in the trace starting at start and
+// lasting total.
+func traceBar(s TraceSpan, start time.Time, total time.Duration) string {
+	scale := func(d time.Duration) int {
+		return int(float64(d) / float64(total) * traceBarWidth)
+	}
+	offset := min(max(scale(s.Start.Sub(start)), 0), traceBarWidth-1)
+	width := min(max(scale(s.End.Sub(s.Start)), 1), traceBarWidth-offset)
+	return strings.Repeat(" ", offset) + strings.Repeat("█", width) + strings.Repeat(" ", traceBarWidth-offset-width)
+}
+
+type serviceTime struct {
+	service string
+	time    time.Duration
+}
+
+// serviceTimes returns the time spent in each service, most first. The time
+// of a span is its own, the time of its children is spent in their service.
+func serviceTimes(spans []TraceSpan) []serviceTime {
+	times := make(map[string]time.Duration)
+	for i, s := range spans {
+		own := s.End.Sub(s.Start)
+		for j, child := range spans {
+			if s.SpanID != "" && i != j && child.ParentSpanID == s.SpanID {
+				own -= child.End.Sub(child.Start)
+			}
+		}
+		times[cmp.Or(s.Service, "unknown")] += max(own, 0)
+	}
+	var result []serviceTime
+	for _, service := range slices.Sorted(maps.Keys(times)) {
+		result = append(result, serviceTime{service, times[service]})
+	}
+	slices.SortStableFunc(result, func(a, b serviceTime) int { return cmp.Compare(b.time, a.time) })
+	return result
+}
+
+func formatSpanDuration(d time.Duration) string {
+	if d < time.Millisecond {
+		return d.Round(time.Microsecond).String()
+	}
+	return d.Round(time.Millisecond / 10).String()
+}
+
+// otlpTraces is the OTLP JSON encoding of an ExportTraceServiceRequest, with
+// hex encoded IDs and the times as strings of Unix nanoseconds.
+type otlpTraces struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpAttribute `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceID           string          `json:"traceId"`
+	SpanID            string          `json:"spanId"`
+	ParentSpanID      string          `json:"parentSpanId,omitempty"`
+	Name              string          `json:"name"`
+	Kind              int             `json:"kind"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+	Attributes        []otlpAttribute `json:"attributes,omitempty"`
+	Status            otlpStatus      `json:"status"`
+}
+
+type otlpAttribute struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpValue struct {
+	StringValue string `json:"stringValue"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+const (
+	otlpSpanKindInternal = 1
+	otlpStatusError      = 2
+)
+
+// toOTLP returns the traces as OTLP JSON, with a resource per zone and
+// service.
+func toOTLP(traces []zoneTrace) otlpTraces {
+	type resourceKey struct{ zone, service string }
+	var (
+		keys      []resourceKey
+		resources = make(map[resourceKey][]otlpSpan)
+	)
+	for _, t := range traces {
+		for _, s := range t.Spans {
+			key := resourceKey{t.Zone, s.Service}
+			if _, ok := resources[key]; !ok {
+				keys = append(keys, key)
+			}
+
+			span := otlpSpan{
+				TraceID:           t.TraceID,
+				SpanID:            s.SpanID,
+				ParentSpanID:      s.ParentSpanID,
+				Name:              s.Name,
+				Kind:              otlpSpanKindInternal,
+				StartTimeUnixNano: strconv.FormatInt(s.Start.UnixNano(), 10),
+				EndTimeUnixNano:   strconv.FormatInt(s.End.UnixNano(), 10),
+				Attributes:        []otlpAttribute{{Key: "yc.request_id", Value: otlpValue{t.RequestID}}},
+			}
+			for _, k := range slices.Sorted(maps.Keys(s.Attributes)) {
+				span.Attributes = append(span.Attributes, otlpAttribute{Key: k, Value: otlpValue{s.Attributes[k]}})
+			}
+			if s.Error != "" {
+				span.Status = otlpStatus{Code: otlpStatusError, Message: s.Error}
+			}
+			resources[key] = append(resources[key], span)
+		}
+	}
+
+	result := otlpTraces{ResourceSpans: []otlpResourceSpans{}}
+	for _, key := range keys {
+		result.ResourceSpans = append(result.ResourceSpans, otlpResourceSpans{
+			Resource: otlpResource{Attributes: []otlpAttribute{
+				{Key: "service.name", Value: otlpValue{key.service}},
+				{Key: "yc.zone", Value: otlpValue{key.zone}},
+			}},
+			ScopeSpans: []otlpScopeSpans{{Scope: otlpScope{Name: "yc"}, Spans: resources[key]}},
+		})
+	}
+	return result
+}
@@ -0,0 +1,115 @@
+package pkg
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testTrace() zoneTrace {
+	start := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	at := func(ms int) time.Time { return start.Add(time.Duration(ms) * time.Millisecond) }
+	return zoneTrace{Zone: "zone-a", InvocationTrace: InvocationTrace{
+		RequestID: "req-1",
+		TraceID:   "0af7651916cd43dd8448eb211c80319c",
+		Spans: []TraceSpan{
+			{SpanID: "03", ParentSpanID: "01", Name: "handler", Service: "tool", Start: at(20), End: at(100), Error: "timeout"},
+			{SpanID: "01", Name: "invoke", Service: "zipper", Start: at(0), End: at(200)},
+			{SpanID: "02", ParentSpanID: "01", Name: "route", Service: "zipper", Start: at(0), End: at(10)},
+			{SpanID: "04", ParentSpanID: "03", Name: "llm call", Service: "tool", Start: at(40), End: at(90), Attributes: map[string]string{"model": "m"}},
+		},
+	}}
+}
+
+func TestPrintWaterfall(t *testing.T) {
+	var out bytes.Buffer
+	printWaterfall(&out, testTrace())
+
+	bar := func(offset, width int) string {
+		return "|" + strings.Repeat(" ", offset) + strings.Repeat("█", width) + strings.Repeat(" ", traceBarWidth-offset-width) + "|"
+	}
+	expected := strings.Join([]string{
+		"req-1 in zone-a at " + testTrace().start().Local().Format(logTimeFormat) + " (200ms), trace 0af7651916cd43dd8448eb211c80319c",
+		"  invoke        zipper  " + bar(0, 40) + "  200ms",
+		"    route       zipper  " + bar(0, 2) + "  10ms",
+		"    handler     tool    " + bar(4, 16) + "  80ms error: timeout",
+		"      llm call  tool    " + bar(8, 10) + "  50ms",
+		"  time by service: zipper 120ms, tool 80ms",
+		"",
+	}, "\n")
+	if out.String() != expected {
+		t.Errorf("Waterfall =\n%s\nwant\n%s", out.String(), expected)
+	}
+}
+
+func TestPrintWaterfallMalformedSpans(t *testing.T) {
+	start := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	at := func(ms int) time.Time { return start.Add(time.Duration(ms) * time.Millisecond) }
+	trace := zoneTrace{Zone: "zone-a", InvocationTrace: InvocationTrace{
+		RequestID: "req-1",
+		Spans: []TraceSpan{
+			{Name: "no id", Service: "zipper", Start: at(0), End: at(100)},
+			{SpanID: "01", ParentSpanID: "01", Name: "own parent", Service: "zipper", Start: at(10), End: at(20)},
+			{SpanID: "02", ParentSpanID: "03", Name: "cycle a", Service: "tool", Start: at(30), End: at(40)},
+			{SpanID: "03", ParentSpanID: "02", Name: "cycle b", Service: "tool", Start: at(50), End: at(60)},
+		},
+	}}
+
+	done := make(chan string)
+	go func() {
+		var out bytes.Buffer
+		printWaterfall(&out, trace)
+		done <- out.String()
+	}()
+	select {
+	case out := <-done:
+		for _, expected := range []string{"\n  no id ", "\n  own parent ", "\n  cycle a ", "\n    cycle b "} {
+			if !strings.Contains(out, expected) {
+				t.Errorf("Waterfall %q does not contain %q", out, expected)
+			}
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("printWaterfall did not return")
+	}
+}
+
+func TestParseTraces(t *testing.T) {
+	traces, failures := parseTraces([]Response{
+		{MeshZone: "zone-b", Msg: `{"traces":[{"request_id":"b","spans":[{"span_id":"1","start":"2026-03-01T12:00:02Z","end":"2026-03-01T12:00:03Z"}]}]}`},
+		{MeshZone: "zone-a", Msg: `{"traces":[{"request_id":"a","spans":[{"span_id":"1","start":"2026-03-01T12:00:01Z","end":"2026-03-01T12:00:03Z"}]},{"request_id":"empty"}]}`},
+		{MeshZone: "zone-c", Error: "tool not deployed"},
+	})
+	if len(traces) != 2 || traces[0].RequestID != "a" || traces[1].RequestID != "b" {
+		t.Errorf("Expected the traces a and b oldest first, got %+v", traces)
+	}
+	if len(failures) != 1 || failures[0] != "[zone-c] Error: tool not deployed" {
+		t.Errorf("Unexpected failures %q", failures)
+	}
+
+	var out bytes.Buffer
+	printTraces(&out, nil)
+	if out.String() != "No traces found\n" {
+		t.Errorf("Expected no traces, got %q", out.String())
+	}
+}
+
+func TestToOTLP(t *testing.T) {
+	otlp := toOTLP([]zoneTrace{testTrace()})
+	if len(otlp.ResourceSpans) != 2 {
+		t.Fatalf("Expected a resource per service, got %+v", otlp.ResourceSpans)
+	}
+	tool := otlp.ResourceSpans[0]
+	if tool.Resource.Attributes[0].Value.StringValue != "tool" || tool.Resource.Attributes[1].Value.StringValue != "zone-a" {
+		t.Errorf("Unexpected resource %+v", tool.Resource)
+	}
+	handler := tool.ScopeSpans[0].Spans[0]
+	if handler.TraceID != "0af7651916cd43dd8448eb211c80319c" || handler.ParentSpanID != "01" ||
+		handler.StartTimeUnixNano != "1772366400020000000" || handler.Status.Code != otlpStatusError {
+		t.Errorf("Unexpected span %+v", handler)
+	}
+	llm := tool.ScopeSpans[0].Spans[1]
+	if len(llm.Attributes) != 2 || llm.Attributes[0].Key != "yc.request_id" || llm.Attributes[1].Key != "model" {
+		t.Errorf("Unexpected attributes %+v", llm.Attributes)
+	}
+}
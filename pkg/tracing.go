@@ -0,0 +1,137 @@
+package pkg
+
+import (
+	"context"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.34.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// tracerName is the instrumentation scope of the spans of yc.
+	tracerName = "github.com/vivgrid/yc"
+
+	// tracingShutdownTimeout bounds the export of the spans when yc exits.
+	tracingShutdownTimeout = 5 * time.Second
+)
+
+// tracingEnabled reports whether an OTLP endpoint is set in the
+// OTEL_EXPORTER_OTLP_* env vars, and the SDK is not disabled.
+func tracingEnabled() bool {
+	if strings.EqualFold(os.Getenv("OTEL_SDK_DISABLED"), "true") {
+		return false
+	}
+	return os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") != "" || os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT") != ""
+}
+
+// startTracing starts the span of cmd, exported over OTLP/HTTP as configured
+// by the OTEL_EXPORTER_OTLP_* env vars. Nothing is traced without an
+// endpoint. The tracer provider is not made global, the stream functions of
+// yomo replace the global one.
+func (c *command) startTracing(cmd *cobra.Command) error {
+	if !tracingEnabled() {
+		return nil
+	}
+	ctx := context.Background()
+	exporter, err := otlptracehttp.New(ctx)
+	if err != nil {
+		return err
+	}
+	// OTEL_SERVICE_NAME and OTEL_RESOURCE_ATTRIBUTES take precedence
+	res, err := resource.New(ctx,
+		resource.WithAttributes(semconv.ServiceName("yc"), semconv.ServiceVersion(CliVersion)),
+		resource.WithFromEnv(),
+	)
+	if err != nil {
+		return err
+	}
+	c.tracing = sdktrace.NewTracerProvider(sdktrace.WithBatcher(exporter), sdktrace.WithResource(res))
+
+	ctx, c.rootSpan = c.tracing.Tracer(tracerName).Start(ctx, cmd.CommandPath(), trace.WithAttributes(
+		attribute.String("yc.tool", c.tool),
+		attribute.String("yc.zipper", c.zipperAddr),
+	))
+	c.spanCtx.Store(&ctx)
+	return nil
+}
+
+// stopTracing ends the span of the command and exports the spans.
+func (c *command) stopTracing(failed bool) {
+	if c.tracing == nil {
+		return
+	}
+	if failed {
+		c.rootSpan.SetStatus(codes.Error, "command failed")
+	}
+	c.rootSpan.End()
+
+	ctx, cancel := context.WithTimeout(context.Background(), tracingShutdownTimeout)
+	defer cancel()
+	if err := c.tracing.Shutdown(ctx); err != nil {
+		c.logger.Warn("failed to export the traces", "error", err)
+	}
+	c.tracing = nil
+}
+
+// exit exits with code, once the spans are exported and the logs flushed.
+func (c *command) exit(code int) {
+	c.stopTracing(code != 0)
+	c.closeLogFile()
+	os.Exit(code)
+}
+
+// traceCtx returns the context of the current span of c.
+func (c *command) traceCtx() context.Context {
+	if ctx := c.spanCtx.Load(); ctx != nil {
+		return *ctx
+	}
+	return context.Background()
+}
+
+// startSpan starts a child of the current span of c, which is not recorded
+// when tracing is disabled.
+func (c *command) startSpan(name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	ctx := c.traceCtx()
+	return trace.SpanFromContext(ctx).TracerProvider().Tracer(tracerName).Start(ctx, name, opts...)
+}
+
+// endSpan ends span, with an error status when err is set.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// traceResponse records the response of a zone as a span from the request
+// to the response, the latency of the zone. The log lines are not recorded.
+func (c *command) traceResponse(res *Response, size int) {
+	_, span := c.startSpan("response", trace.WithTimestamp(time.Unix(0, c.sentAt.Load())), trace.WithAttributes(
+		attribute.String("yc.zone", res.MeshZone),
+		attribute.Bool("yc.done", res.Done),
+		attribute.Int("yc.response.size", size),
+	))
+	if res.Error != "" {
+		span.SetStatus(codes.Error, res.Error)
+	}
+	span.End()
+}
+
+// pack packages the source of args like packSource, in a span.
+func (c *command) pack(args []string, opts ...ZipOption) ([]byte, Runtime, error) {
+	_, span := c.startSpan("package", trace.WithAttributes(attribute.StringSlice("yc.sources", args)))
+	data, runtime, err := packSource(args, opts...)
+	span.SetAttributes(attribute.Int("yc.archive.size", len(data)), attribute.String("yc.runtime", string(runtime)))
+	endSpan(span, err)
+	return data, runtime, err
+}
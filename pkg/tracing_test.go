@@ -0,0 +1,33 @@
+package pkg
+
+import "testing"
+
+func TestTracingEnabled(t *testing.T) {
+	tests := []struct {
+		endpoint, tracesEndpoint, disabled string
+		expected                           bool
+	}{
+		{"", "", "", false},
+		{"http://localhost:4318", "", "", true},
+		{"", "http://localhost:4318/v1/traces", "", true},
+		{"http://localhost:4318", "", "true", false},
+	}
+	for _, tt := range tests {
+		t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", tt.endpoint)
+		t.Setenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT", tt.tracesEndpoint)
+		t.Setenv("OTEL_SDK_DISABLED", tt.disabled)
+		if got := tracingEnabled(); got != tt.expected {
+			t.Errorf("tracingEnabled() with %+v = %v, want %v", tt, got, tt.expected)
+		}
+	}
+}
+
+func TestSpansWithoutTracing(t *testing.T) {
+	c := &command{}
+	_, span := c.startSpan("package")
+	if span.IsRecording() {
+		t.Error("Expected spans not to be recorded without tracing")
+	}
+	span.End()
+	c.stopTracing(true)
+}
@@ -0,0 +1,307 @@
+package pkg
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"golang.org/x/mod/semver"
+)
+
+// DefaultReleaseURL is where releases are published, as laid out by GitHub:
+// {url}/latest redirects to the latest tag and assets are downloaded from
+// {url}/download/{tag}/{asset}. A mirror may serve {url}/latest as a plain
+// text file holding the tag instead.
+const DefaultReleaseURL = "https://github.com/vivgrid/yc/releases"
+
+// ReleasePublicKey is the public key the release checksums are signed with,
+// base64 DER or PEM encoded. It is set at build time.
+var ReleasePublicKey = ""
+
+// maxReleaseAssetSize bounds the size of downloaded release assets.
+const maxReleaseAssetSize = 256 << 20
+
+// updater downloads and verifies release archives.
+type updater struct {
+	releaseURL string
+	// publicKey verifies the checksums signature, nil skips the check
+	publicKey crypto.PublicKey
+	client    *http.Client
+	goos      string
+	goarch    string
+}
+
+func newUpdater(releaseURL string, publicKey crypto.PublicKey) *updater {
+	return &updater{
+		releaseURL: strings.TrimSuffix(releaseURL, "/"),
+		publicKey:  publicKey,
+		client:     http.DefaultClient,
+		goos:       runtime.GOOS,
+		goarch:     runtime.GOARCH,
+	}
+}
+
+// latest returns the tag of the latest release.
+func (u *updater) latest(ctx context.Context) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.releaseURL+"/latest", nil)
+	if err != nil {
+		return "", err
+	}
+	client := *u.client
+	client.CheckRedirect = func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+
+	var tag string
+	switch {
+	case res.StatusCode >= 300 && res.StatusCode < 400:
+		tag = path.Base(res.Header.Get("Location"))
+	case res.StatusCode == http.StatusOK:
+		body, err := io.ReadAll(io.LimitReader(res.Body, 256))
+		if err != nil {
+			return "", err
+		}
+		tag = strings.TrimSpace(string(body))
+	default:
+		return "", fmt.Errorf("failed to get the latest release: %s", res.Status)
+	}
+
+	if !semver.IsValid(tag) {
+		return "", fmt.Errorf("unexpected latest release %q", tag)
+	}
+	return tag, nil
+}
+
+// archiveName returns the name of the release archive of the platform,
+// following the yc-{arch}-{os} naming of .goreleaser.yml.
+func (u *updater) archiveName() string {
+	return fmt.Sprintf("yc-%s-%s.tar.gz", u.goarch, u.goos)
+}
+
+// checksumsName returns the name of the checksums file of release tag.
+func checksumsName(tag string) string {
+	return fmt.Sprintf("yc_%s_checksums.txt", strings.TrimPrefix(tag, "v"))
+}
+
+// fetch downloads the yc binary of release tag for the platform, after
+// verifying the signature of the checksums and the checksum of the archive.
+func (u *updater) fetch(ctx context.Context, tag string) ([]byte, error) {
+	checksums, err := u.download(ctx, tag, checksumsName(tag))
+	if err != nil {
+		return nil, err
+	}
+	if u.publicKey != nil {
+		sig, err := u.download(ctx, tag, checksumsName(tag)+".sig")
+		if err != nil {
+			return nil, err
+		}
+		if err := verifySignature(u.publicKey, checksums, sig); err != nil {
+			return nil, err
+		}
+	}
+
+	archive, err := u.download(ctx, tag, u.archiveName())
+	if err != nil {
+		return nil, err
+	}
+	if err := verifyChecksum(checksums, u.archiveName(), archive); err != nil {
+		return nil, err
+	}
+
+	binary := "yc"
+	if u.goos == "windows" {
+		binary += ".exe"
+	}
+	return extractFile(archive, binary)
+}
+
+func (u *updater) download(ctx context.Context, tag, asset string) ([]byte, error) {
+	url := fmt.Sprintf("%s/download/%s/%s", u.releaseURL, tag, asset)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := u.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to download %s: %s", url, res.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(res.Body, maxReleaseAssetSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxReleaseAssetSize {
+		return nil, fmt.Errorf("%s exceeds %s", asset, formatSize(maxReleaseAssetSize))
+	}
+	return data, nil
+}
+
+// verifyChecksum checks data against the sha256 of name in a checksums file
+// of "<hex>  <name>" lines.
+func verifyChecksum(checksums []byte, name string, data []byte) error {
+	scanner := bufio.NewScanner(bytes.NewReader(checksums))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 || fields[1] != name {
+			continue
+		}
+		want, err := hex.DecodeString(fields[0])
+		if err != nil {
+			return fmt.Errorf("invalid checksum of %s: %w", name, err)
+		}
+		got := sha256.Sum256(data)
+		if !bytes.Equal(got[:], want) {
+			return fmt.Errorf("checksum mismatch for %s", name)
+		}
+		return nil
+	}
+	return fmt.Errorf("no checksum for %s", name)
+}
+
+// verifySignature checks the base64 encoded signature sig of data, as made
+// by `cosign sign-blob` for ECDSA keys or plain Ed25519.
+func verifySignature(publicKey crypto.PublicKey, data, sig []byte) error {
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(sig)))
+	if err != nil {
+		return fmt.Errorf("invalid signature: %w", err)
+	}
+
+	var ok bool
+	switch key := publicKey.(type) {
+	case *ecdsa.PublicKey:
+		digest := sha256.Sum256(data)
+		ok = ecdsa.VerifyASN1(key, digest[:], raw)
+	case ed25519.PublicKey:
+		ok = ed25519.Verify(key, data, raw)
+	default:
+		return fmt.Errorf("unsupported public key type %T", publicKey)
+	}
+	if !ok {
+		return errors.New("signature verification failed")
+	}
+	return nil
+}
+
+// ParsePublicKey parses a PEM or base64 DER encoded PKIX public key.
+func ParsePublicKey(s string) (crypto.PublicKey, error) {
+	der := []byte(strings.TrimSpace(s))
+	if block, _ := pem.Decode(der); block != nil {
+		der = block.Bytes
+	} else {
+		decoded, err := base64.StdEncoding.DecodeString(string(der))
+		if err != nil {
+			return nil, fmt.Errorf("invalid public key: %w", err)
+		}
+		der = decoded
+	}
+	key, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		return nil, fmt.Errorf("invalid public key: %w", err)
+	}
+	return key, nil
+}
+
+// extractFile returns the content of the file named name in a tar.gz archive.
+func extractFile(archive []byte, name string) ([]byte, error) {
+	gr, err := gzip.NewReader(bytes.NewReader(archive))
+	if err != nil {
+		return nil, err
+	}
+	defer gr.Close()
+
+	tr := tar.NewReader(gr)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil, fmt.Errorf("%s not found in the release archive", name)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if header.Typeflag == tar.TypeReg && path.Base(header.Name) == name {
+			return io.ReadAll(io.LimitReader(tr, maxReleaseAssetSize))
+		}
+	}
+}
+
+// replaceExecutable atomically replaces the executable exe with binary, by
+// renaming a temporary file written next to it. On Windows the running
+// executable can't be overwritten, it is moved aside to exe.old first, and
+// removed by the next run, see removeOldExecutable.
+func replaceExecutable(exe string, binary []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(exe), ".yc-update-*")
+	if err != nil {
+		return err
+	}
+	tmpPath := tmp.Name()
+	defer os.Remove(tmpPath)
+
+	if _, err := tmp.Write(binary); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmpPath, 0755); err != nil {
+		return err
+	}
+
+	if runtime.GOOS == "windows" {
+		old := exe + ".old"
+		os.Remove(old)
+		if err := os.Rename(exe, old); err != nil {
+			return err
+		}
+	}
+	return os.Rename(tmpPath, exe)
+}
+
+// removeOldExecutable removes the exe.old left next to the executable exe by
+// a self-update on Windows, once the updated executable runs.
+func removeOldExecutable(exe string) {
+	old := exe + ".old"
+	if _, err := os.Stat(old); err == nil {
+		os.Remove(old)
+	}
+}
+
+// isNewer reports whether release tag is newer than version. Development
+// builds are older than any release.
+func isNewer(tag, version string) bool {
+	if !strings.HasPrefix(version, "v") {
+		version = "v" + version
+	}
+	if !semver.IsValid(version) {
+		return true
+	}
+	return semver.Compare(tag, version) > 0
+}
@@ -0,0 +1,259 @@
+package pkg
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// testRelease serves a signed release the way GitHub lays it out.
+type testRelease struct {
+	key    *ecdsa.PrivateKey
+	assets map[string][]byte
+	server *httptest.Server
+}
+
+func newTestRelease(t *testing.T, tag string, binary []byte) *testRelease {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+
+	var archive bytes.Buffer
+	gw := gzip.NewWriter(&archive)
+	tw := tar.NewWriter(gw)
+	tw.WriteHeader(&tar.Header{Name: "README.md", Mode: 0644, Size: 2, Typeflag: tar.TypeReg})
+	tw.Write([]byte("hi"))
+	tw.WriteHeader(&tar.Header{Name: "yc", Mode: 0755, Size: int64(len(binary)), Typeflag: tar.TypeReg})
+	tw.Write(binary)
+	tw.Close()
+	gw.Close()
+
+	u := &updater{goos: "linux", goarch: "amd64"}
+	sum := sha256.Sum256(archive.Bytes())
+	checksums := []byte(fmt.Sprintf("%s  %s\n%s  other.tar.gz\n", hex.EncodeToString(sum[:]), u.archiveName(), strings.Repeat("0", 64)))
+	digest := sha256.Sum256(checksums)
+	sig, err := ecdsa.SignASN1(rand.Reader, key, digest[:])
+	if err != nil {
+		t.Fatalf("Failed to sign checksums: %v", err)
+	}
+
+	r := &testRelease{
+		key: key,
+		assets: map[string][]byte{
+			"/download/" + tag + "/" + u.archiveName():             archive.Bytes(),
+			"/download/" + tag + "/" + checksumsName(tag):          checksums,
+			"/download/" + tag + "/" + checksumsName(tag) + ".sig": []byte(base64.StdEncoding.EncodeToString(sig)),
+		},
+	}
+	r.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == "/latest" {
+			http.Redirect(w, req, "/tag/"+tag, http.StatusFound)
+			return
+		}
+		data, ok := r.assets[req.URL.Path]
+		if !ok {
+			http.NotFound(w, req)
+			return
+		}
+		w.Write(data)
+	}))
+	t.Cleanup(r.server.Close)
+	return r
+}
+
+func (r *testRelease) updater(t *testing.T) *updater {
+	t.Helper()
+	u := newUpdater(r.server.URL+"/", &r.key.PublicKey)
+	u.goos, u.goarch = "linux", "amd64"
+	return u
+}
+
+func TestUpdaterFetch(t *testing.T) {
+	binary := []byte("new yc binary")
+	r := newTestRelease(t, "v1.2.3", binary)
+	u := r.updater(t)
+
+	tag, err := u.latest(context.Background())
+	if err != nil {
+		t.Fatalf("latest failed: %v", err)
+	}
+	if tag != "v1.2.3" {
+		t.Errorf("latest() = %s, want v1.2.3", tag)
+	}
+
+	got, err := u.fetch(context.Background(), tag)
+	if err != nil {
+		t.Fatalf("fetch failed: %v", err)
+	}
+	if !bytes.Equal(got, binary) {
+		t.Errorf("fetch() = %q, want %q", got, binary)
+	}
+}
+
+func TestUpdaterLatestPlainText(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		fmt.Fprintln(w, "v2.0.0")
+	}))
+	defer server.Close()
+
+	tag, err := newUpdater(server.URL, nil).latest(context.Background())
+	if err != nil {
+		t.Fatalf("latest failed: %v", err)
+	}
+	if tag != "v2.0.0" {
+		t.Errorf("latest() = %s, want v2.0.0", tag)
+	}
+}
+
+func TestUpdaterFetchTampered(t *testing.T) {
+	tests := []struct {
+		name     string
+		tamper   func(r *testRelease)
+		expected string
+	}{
+		{
+			name: "archive",
+			tamper: func(r *testRelease) {
+				r.assets["/download/v1.2.3/yc-amd64-linux.tar.gz"] = []byte("evil")
+			},
+			expected: "checksum mismatch",
+		},
+		{
+			name: "checksums",
+			tamper: func(r *testRelease) {
+				r.assets["/download/v1.2.3/yc_1.2.3_checksums.txt"] = []byte("evil")
+			},
+			expected: "signature verification failed",
+		},
+		{
+			name: "signature",
+			tamper: func(r *testRelease) {
+				delete(r.assets, "/download/v1.2.3/yc_1.2.3_checksums.txt.sig")
+			},
+			expected: "404",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newTestRelease(t, "v1.2.3", []byte("new yc binary"))
+			tt.tamper(r)
+
+			_, err := r.updater(t).fetch(context.Background(), "v1.2.3")
+			if err == nil || !strings.Contains(err.Error(), tt.expected) {
+				t.Errorf("fetch() = %v, want error containing %q", err, tt.expected)
+			}
+		})
+	}
+}
+
+func TestParsePublicKey(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatalf("Failed to marshal key: %v", err)
+	}
+
+	for _, encoded := range []string{
+		base64.StdEncoding.EncodeToString(der),
+		string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})),
+	} {
+		parsed, err := ParsePublicKey(encoded)
+		if err != nil {
+			t.Fatalf("ParsePublicKey failed: %v", err)
+		}
+		if !key.PublicKey.Equal(parsed) {
+			t.Errorf("ParsePublicKey(%q) returned a different key", encoded)
+		}
+	}
+
+	if _, err := ParsePublicKey("not a key"); err == nil {
+		t.Error("Expected error for an invalid key")
+	}
+}
+
+func TestReplaceExecutable(t *testing.T) {
+	exe := filepath.Join(t.TempDir(), "yc")
+	if err := os.WriteFile(exe, []byte("old"), 0755); err != nil {
+		t.Fatalf("Failed to create file %s: %v", exe, err)
+	}
+
+	if err := replaceExecutable(exe, []byte("new")); err != nil {
+		t.Fatalf("replaceExecutable failed: %v", err)
+	}
+
+	data, err := os.ReadFile(exe)
+	if err != nil {
+		t.Fatalf("Failed to read file %s: %v", exe, err)
+	}
+	if string(data) != "new" {
+		t.Errorf("Executable content = %q, want %q", data, "new")
+	}
+	if info, _ := os.Stat(exe); info.Mode().Perm()&0100 == 0 {
+		t.Errorf("Executable mode = %v, want executable", info.Mode())
+	}
+
+	entries, _ := os.ReadDir(filepath.Dir(exe))
+	if len(entries) != 1 {
+		t.Errorf("Expected only the executable to remain, got %d entries", len(entries))
+	}
+}
+
+func TestRemoveOldExecutable(t *testing.T) {
+	exe := filepath.Join(t.TempDir(), "yc.exe")
+	for _, p := range []string{exe, exe + ".old"} {
+		if err := os.WriteFile(p, []byte("yc"), 0755); err != nil {
+			t.Fatalf("Failed to create file %s: %v", p, err)
+		}
+	}
+
+	removeOldExecutable(exe)
+
+	if _, err := os.Stat(exe + ".old"); !os.IsNotExist(err) {
+		t.Errorf("Expected %s.old to be removed, got %v", exe, err)
+	}
+	if _, err := os.Stat(exe); err != nil {
+		t.Errorf("Expected %s to remain: %v", exe, err)
+	}
+}
+
+func TestIsNewer(t *testing.T) {
+	tests := []struct {
+		tag      string
+		version  string
+		expected bool
+	}{
+		{"v1.2.3", "1.2.2", true},
+		{"v1.2.3", "v1.2.3", false},
+		{"v1.2.3", "1.3.0", false},
+		{"v1.2.3", "devel", true},
+	}
+
+	for _, tt := range tests {
+		if got := isNewer(tt.tag, tt.version); got != tt.expected {
+			t.Errorf("isNewer(%s, %s) = %v, want %v", tt.tag, tt.version, got, tt.expected)
+		}
+	}
+}
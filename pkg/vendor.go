@@ -0,0 +1,53 @@
+package pkg
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// vendorModule runs `go mod vendor` for the module at modRoot, writing the
+// vendor directory into a temporary location so the source tree is left
+// untouched. The caller must remove the returned directory.
+//
+// Local replace targets are copied into the vendor directory by the go tool,
+// so the result builds offline with the module's go.mod as-is. A go.work
+// above the module is ignored, go mod vendor refuses the workspace mode.
+func vendorModule(modRoot string) (string, error) {
+	if _, err := os.Stat(filepath.Join(modRoot, "go.mod")); err != nil {
+		return "", fmt.Errorf("vendor: no go.mod found in %s", modRoot)
+	}
+	goBin, err := exec.LookPath("go")
+	if err != nil {
+		return "", errors.New("vendor: the go toolchain is required to vendor dependencies")
+	}
+
+	tmpDir, err := os.MkdirTemp("", "yc-vendor-*")
+	if err != nil {
+		return "", err
+	}
+	vendorDir := filepath.Join(tmpDir, "vendor")
+
+	log.Printf("Vendoring module dependencies of %s", modRoot)
+	var stderr bytes.Buffer
+	cmd := exec.Command(goBin, "mod", "vendor", "-o", vendorDir)
+	cmd.Dir = modRoot
+	cmd.Env = append(os.Environ(), "GOWORK=off")
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		os.RemoveAll(tmpDir)
+		return "", fmt.Errorf("vendor: go mod vendor failed: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	// a module without dependencies produces no vendor directory
+	if err := os.MkdirAll(vendorDir, 0755); err != nil {
+		os.RemoveAll(tmpDir)
+		return "", err
+	}
+	return vendorDir, nil
+}
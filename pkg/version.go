@@ -1,5 +1,10 @@
 package pkg
 
-const SpecVersion uint32 = 2
+// SpecVersion is the newest spec version spoken by this CLI, MinSpecVersion
+// the oldest one. The version used is negotiated with the server.
+const (
+	SpecVersion    uint32 = 2
+	MinSpecVersion uint32 = 2
+)
 
 var CliVersion = "devel"
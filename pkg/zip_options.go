@@ -0,0 +1,115 @@
+package pkg
+
+import (
+	"fmt"
+	"io"
+	"log"
+)
+
+// ZipOption configures how ZipWithExclusions and ZipGoFiles build the archive.
+type ZipOption func(*zipOptions)
+
+type zipOptions struct {
+	vendor         bool
+	maxArchiveSize int64
+	maxFileSize    int64
+	largestFiles   int
+	explain        io.Writer
+	symlinks       SymlinkPolicy
+	quiet          bool
+}
+
+// SymlinkPolicy defines how symlinks found in the source tree are packaged.
+type SymlinkPolicy string
+
+const (
+	// SymlinkFollow includes the content of the link target, which must be
+	// inside the source tree. This is the default.
+	SymlinkFollow SymlinkPolicy = "follow"
+	// SymlinkStore stores the link itself, pointing to a target inside the
+	// source tree.
+	SymlinkStore SymlinkPolicy = "store"
+	// SymlinkReject fails packaging when a symlink is found.
+	SymlinkReject SymlinkPolicy = "reject"
+)
+
+// ParseSymlinkPolicy parses a symlink policy name.
+func ParseSymlinkPolicy(s string) (SymlinkPolicy, error) {
+	switch p := SymlinkPolicy(s); p {
+	case SymlinkFollow, SymlinkStore, SymlinkReject:
+		return p, nil
+	default:
+		return "", fmt.Errorf("invalid symlink policy %q, must be one of follow, store or reject", s)
+	}
+}
+
+// WithVendor vendors the module dependencies into the archive, so the remote
+// builder doesn't need to fetch private modules or resolve local replace
+// directives.
+func WithVendor() ZipOption {
+	return func(o *zipOptions) {
+		o.vendor = true
+	}
+}
+
+// WithMaxArchiveSize fails packaging once the compressed archive is larger
+// than max bytes, 0 means no limit.
+func WithMaxArchiveSize(max int64) ZipOption {
+	return func(o *zipOptions) {
+		o.maxArchiveSize = max
+	}
+}
+
+// WithMaxFileSize fails packaging when a single included file is larger than
+// max bytes, 0 means no limit.
+func WithMaxFileSize(max int64) ZipOption {
+	return func(o *zipOptions) {
+		o.maxFileSize = max
+	}
+}
+
+// WithLargestFiles logs the n largest included files once the archive is
+// written, or when a size limit is exceeded.
+func WithLargestFiles(n int) ZipOption {
+	return func(o *zipOptions) {
+		o.largestFiles = n
+	}
+}
+
+// WithExplain writes, for every path visited by ZipWithExclusions, whether it
+// was included or excluded and by which ignore rule.
+func WithExplain(w io.Writer) ZipOption {
+	return func(o *zipOptions) {
+		o.explain = w
+	}
+}
+
+// WithQuiet doesn't log the progress of the packaging, such as the ignored
+// paths, the errors are still returned.
+func WithQuiet() ZipOption {
+	return func(o *zipOptions) {
+		o.quiet = true
+	}
+}
+
+// WithSymlinks sets how symlinks in the source tree are packaged.
+func WithSymlinks(policy SymlinkPolicy) ZipOption {
+	return func(o *zipOptions) {
+		o.symlinks = policy
+	}
+}
+
+// logf logs the progress of the packaging, unless WithQuiet is given.
+func (o *zipOptions) logf(format string, args ...any) {
+	if !o.quiet {
+		log.Printf(format, args...)
+	}
+}
+
+func newZipOptions(opts []ZipOption) *zipOptions {
+	o := &zipOptions{symlinks: SymlinkFollow}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
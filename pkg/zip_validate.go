@@ -0,0 +1,136 @@
+package pkg
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"strings"
+)
+
+const (
+	// maxZipEntries is the max number of entries accepted in a provided zip.
+	maxZipEntries = 10000
+	// maxZipUncompressedSize is the max total uncompressed size of a provided zip.
+	maxZipUncompressedSize = 1 << 30
+	// maxZipCompressionRatio is the max compression ratio of a single entry,
+	// higher ratios are typical for zip bombs.
+	maxZipCompressionRatio = 100
+	// zipRatioCheckSize is the uncompressed size from which the compression
+	// ratio is checked, small files may legitimately compress very well.
+	zipRatioCheckSize = 1 << 20
+)
+
+// ValidateZip inspects a user provided zip archive before it is uploaded. It
+// rejects entries with absolute paths or escaping the archive root with "..",
+// symlinks pointing outside the archive, and archives whose entry count,
+// uncompressed size or compression ratio look like a zip bomb. The size
+// limits of WithMaxArchiveSize and WithMaxFileSize are applied as well. The
+// sizes in the headers can lie, the entries are decompressed to count their
+// actual size, up to the limits.
+func ValidateZip(data []byte, opts ...ZipOption) error {
+	options := newZipOptions(opts)
+
+	if max := options.maxArchiveSize; max > 0 && int64(len(data)) > max {
+		return fmt.Errorf("zip is %s, exceeding the max size of %s", formatSize(int64(len(data))), formatSize(max))
+	}
+
+	r, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return fmt.Errorf("invalid zip: %w", err)
+	}
+	if len(r.File) > maxZipEntries {
+		return fmt.Errorf("zip has %d entries, exceeding the max of %d", len(r.File), maxZipEntries)
+	}
+
+	var total int64
+	for _, f := range r.File {
+		if err := validateZipName(f.Name); err != nil {
+			return err
+		}
+
+		limit := int64(maxZipUncompressedSize) - total
+		if max := options.maxFileSize; max > 0 {
+			limit = min(limit, max)
+		}
+		size, err := zipEntrySize(f, limit)
+		if err != nil {
+			return fmt.Errorf("zip entry %s: %w", f.Name, err)
+		}
+		if max := options.maxFileSize; max > 0 && size > max {
+			return fmt.Errorf("zip entry %s is exceeding the max file size of %s", f.Name, formatSize(max))
+		}
+		if size > zipRatioCheckSize && f.CompressedSize64 > 0 && uint64(size)/f.CompressedSize64 > maxZipCompressionRatio {
+			return fmt.Errorf("zip entry %s has a suspicious compression ratio", f.Name)
+		}
+		total += size
+		if total > maxZipUncompressedSize {
+			return fmt.Errorf("zip uncompressed size exceeds %s", formatSize(maxZipUncompressedSize))
+		}
+
+		if f.Mode()&fs.ModeSymlink != 0 {
+			if err := validateZipSymlink(f); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// zipEntrySize decompresses f and returns its size, or limit+1 once it
+// exceeds limit.
+func zipEntrySize(f *zip.File, limit int64) (int64, error) {
+	if f.FileInfo().IsDir() {
+		return 0, nil
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return 0, err
+	}
+	defer rc.Close()
+
+	n, err := io.Copy(io.Discard, io.LimitReader(rc, limit+1))
+	if err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// validateZipName rejects absolute entry names and names escaping the archive.
+func validateZipName(name string) error {
+	name = strings.ReplaceAll(name, "\\", "/")
+	if strings.HasPrefix(name, "/") || (len(name) > 1 && name[1] == ':') {
+		return fmt.Errorf("zip entry %s has an absolute path", name)
+	}
+	for _, part := range strings.Split(name, "/") {
+		if part == ".." {
+			return fmt.Errorf("zip entry %s escapes the archive root", name)
+		}
+	}
+	return nil
+}
+
+// validateZipSymlink rejects symlink entries pointing outside the archive.
+func validateZipSymlink(f *zip.File) error {
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	target, err := io.ReadAll(io.LimitReader(rc, 4096))
+	if err != nil {
+		return err
+	}
+	link := strings.ReplaceAll(string(target), "\\", "/")
+	if path.IsAbs(link) || (len(link) > 1 && link[1] == ':') {
+		return fmt.Errorf("zip symlink %s points to an absolute path", f.Name)
+	}
+	resolved := path.Join(path.Dir(strings.ReplaceAll(f.Name, "\\", "/")), link)
+	if resolved == ".." || strings.HasPrefix(resolved, "../") {
+		return fmt.Errorf("zip symlink %s points outside the archive", f.Name)
+	}
+	return nil
+}
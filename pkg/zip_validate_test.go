@@ -0,0 +1,123 @@
+package pkg
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/flate"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestValidateZip(t *testing.T) {
+	tests := []struct {
+		name    string
+		entries map[string]string
+		symlink map[string]string
+		opts    []ZipOption
+		wantErr string
+	}{
+		{
+			name:    "valid",
+			entries: map[string]string{"app.go": "package main", "data/dict.txt": "words"},
+			symlink: map[string]string{"data/alias.txt": "dict.txt"},
+		},
+		{
+			name:    "parent directory",
+			entries: map[string]string{"../evil.sh": "rm -rf"},
+			wantErr: "escapes the archive root",
+		},
+		{
+			name:    "absolute path",
+			entries: map[string]string{"/etc/passwd": "root"},
+			wantErr: "absolute path",
+		},
+		{
+			name:    "windows absolute path",
+			entries: map[string]string{"C:\\Windows\\evil.dll": "dll"},
+			wantErr: "absolute path",
+		},
+		{
+			name:    "symlink outside",
+			symlink: map[string]string{"data/passwd": "../../etc/passwd"},
+			wantErr: "points outside the archive",
+		},
+		{
+			name:    "zip bomb",
+			entries: map[string]string{"bomb.txt": strings.Repeat("0", 8<<20)},
+			wantErr: "suspicious compression ratio",
+		},
+		{
+			name:    "max file size",
+			entries: map[string]string{"dataset.bin": strings.Repeat("0", 4096)},
+			opts:    []ZipOption{WithMaxFileSize(1024)},
+			wantErr: "exceeding the max file size",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf := new(bytes.Buffer)
+			w := zip.NewWriter(buf)
+			for name, content := range tt.entries {
+				f, err := w.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate})
+				if err != nil {
+					t.Fatalf("Failed to create zip entry: %v", err)
+				}
+				f.Write([]byte(content))
+			}
+			for name, target := range tt.symlink {
+				header := &zip.FileHeader{Name: name}
+				header.SetMode(os.ModeSymlink | 0777)
+				f, err := w.CreateHeader(header)
+				if err != nil {
+					t.Fatalf("Failed to create zip entry: %v", err)
+				}
+				f.Write([]byte(target))
+			}
+			w.Close()
+
+			err := ValidateZip(buf.Bytes(), tt.opts...)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("ValidateZip failed: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("ValidateZip error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+
+	if err := ValidateZip([]byte("not a zip")); err == nil {
+		t.Error("Expected error for invalid zip data")
+	}
+}
+
+func TestValidateZipLyingHeader(t *testing.T) {
+	var compressed bytes.Buffer
+	fw, _ := flate.NewWriter(&compressed, flate.BestCompression)
+	fw.Write([]byte(strings.Repeat("0", 8<<20)))
+	fw.Close()
+
+	// the header claims a tiny entry
+	buf := new(bytes.Buffer)
+	w := zip.NewWriter(buf)
+	f, err := w.CreateRaw(&zip.FileHeader{
+		Name:               "small.txt",
+		Method:             zip.Deflate,
+		CompressedSize64:   uint64(compressed.Len()),
+		UncompressedSize64: 16,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create zip entry: %v", err)
+	}
+	f.Write(compressed.Bytes())
+	w.Close()
+
+	err = ValidateZip(buf.Bytes(), WithMaxFileSize(1024))
+	if err == nil || !strings.Contains(err.Error(), "zip entry small.txt") {
+		t.Errorf("ValidateZip error = %v, want the entry rejected", err)
+	}
+}
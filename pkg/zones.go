@@ -0,0 +1,130 @@
+package pkg
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// zonesCapability is announced in the hello response by servers honoring the
+// zones of the request envelope. Others would act in every zone.
+const zonesCapability = "zones"
+
+// supportsZones reports whether requests can be restricted to some zones.
+// Unlike supports, it is not assumed when the handshake failed, an older
+// server would silently act in every zone.
+func (c *command) supportsZones() bool {
+	return c.hello != nil && slices.Contains(c.hello.Capabilities, zonesCapability)
+}
+
+// discoverMesh fetches the zones currently in the mesh.
+func (c *command) discoverMesh(timeout time.Duration) ([]MeshZone, error) {
+	res, err := query(c, TAG_REQUEST_MESH, &ReqMsgMesh{}, timeout)
+	if err != nil {
+		return nil, err
+	}
+	var mesh ResMsgMesh
+	if err := json.Unmarshal([]byte(res.Msg), &mesh); err != nil {
+		return nil, fmt.Errorf("[%s] invalid mesh: %w", res.MeshZone, err)
+	}
+	if len(mesh.Zones) == 0 {
+		return nil, fmt.Errorf("[%s] the mesh has no zone", res.MeshZone)
+	}
+	return mesh.Zones, nil
+}
+
+// printMesh prints a row per zone of the mesh.
+func printMesh(w io.Writer, mesh []MeshZone) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ZONE\tREGION\tHEALTH")
+	for _, zone := range mesh {
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", zone.Name, cmp.Or(zone.Region, "-"), cmp.Or(zone.Health, "-"))
+	}
+	tw.Flush()
+}
+
+// checkZones checks that the selected zones are in the discovered mesh.
+func (c *command) checkZones() error {
+	if len(c.mesh) == 0 {
+		return nil
+	}
+	names := make([]string, len(c.mesh))
+	for i, zone := range c.mesh {
+		names[i] = zone.Name
+	}
+	for _, zone := range c.zones {
+		if !slices.Contains(names, zone) {
+			return fmt.Errorf("unknown zone %s, the mesh zones are %s", zone, strings.Join(names, ", "))
+		}
+	}
+	return nil
+}
+
+// awaitedZones returns the zones whose responses complete a request: the
+// selected zones, or the zones of the discovered mesh which are not down.
+// It is empty when the mesh is unknown, meshNum responses are awaited then.
+func (c *command) awaitedZones() []string {
+	if len(c.zones) > 0 {
+		return c.zones
+	}
+	var zones []string
+	for _, zone := range c.mesh {
+		if zone.Health != ZoneDown {
+			zones = append(zones, zone.Name)
+		}
+	}
+	return zones
+}
+
+// expectedResponses is the number of zones expected to answer a request.
+func (c *command) expectedResponses() uint32 {
+	if zones := c.awaitedZones(); len(zones) > 0 {
+		return uint32(len(zones))
+	}
+	return c.meshNum
+}
+
+// allResponded reports whether every awaited zone answered the current
+// request.
+func (c *command) allResponded() bool {
+	zones := c.awaitedZones()
+	if len(zones) == 0 {
+		return c.resCount.Load() >= c.meshNum
+	}
+	for _, zone := range zones {
+		if _, ok := c.respondedZones.Load(zone); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// warnMissingZones warns on w when some zones didn't answer the last
+// request.
+func (c *command) warnMissingZones(w io.Writer) {
+	var n uint32
+	c.respondedZones.Range(func(any, any) bool {
+		n++
+		return true
+	})
+	if expected := c.expectedResponses(); n < expected {
+		fmt.Fprintf(w, "Warning: %d of %d zones responded\n", n, expected)
+	}
+}
+
+// missingZones returns the awaited zones which didn't answer, comma
+// separated.
+func (c *command) missingZones() string {
+	var missing []string
+	for _, zone := range c.awaitedZones() {
+		if _, ok := c.respondedZones.Load(zone); !ok {
+			missing = append(missing, zone)
+		}
+	}
+	return strings.Join(missing, ", ")
+}
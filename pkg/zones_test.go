@@ -0,0 +1,56 @@
+package pkg
+
+import "testing"
+
+func TestZoneSelectionState(t *testing.T) {
+	c := &command{meshNum: 3}
+	if c.expectedResponses() != 3 {
+		t.Errorf("expectedResponses() = %d, want 3", c.expectedResponses())
+	}
+	if c.supportsZones() {
+		t.Error("Expected zones to be unsupported without handshake")
+	}
+
+	c.zones = []string{"zone-a", "zone-b"}
+	c.hello = &ResMsgHello{Capabilities: []string{"status", zonesCapability}}
+	if !c.supportsZones() {
+		t.Error("Expected zones to be supported when announced")
+	}
+	if c.expectedResponses() != 2 {
+		t.Errorf("expectedResponses() = %d, want 2", c.expectedResponses())
+	}
+
+	c.respondedZones.Store("zone-a", true)
+	if missing := c.missingZones(); missing != "zone-b" {
+		t.Errorf("missingZones() = %q, want zone-b", missing)
+	}
+}
+
+func TestDiscoveredMesh(t *testing.T) {
+	c := &command{meshNum: 3, mesh: []MeshZone{
+		{Name: "zone-a", Health: ZoneHealthy},
+		{Name: "zone-b", Health: ZoneDown},
+		{Name: "zone-c", Health: ZoneDegraded},
+	}}
+	if c.expectedResponses() != 2 {
+		t.Errorf("expectedResponses() = %d, want 2", c.expectedResponses())
+	}
+
+	c.respondedZones.Store("zone-a", true)
+	if c.allResponded() {
+		t.Error("Expected zone-c to be awaited")
+	}
+	c.respondedZones.Store("zone-c", true)
+	if !c.allResponded() {
+		t.Error("Expected the zone down not to be awaited")
+	}
+
+	c.zones = []string{"zone-b"}
+	if err := c.checkZones(); err != nil {
+		t.Errorf("checkZones failed: %v", err)
+	}
+	c.zones = []string{"zone-x"}
+	if err := c.checkZones(); err == nil {
+		t.Error("Expected error for an unknown zone")
+	}
+}